@@ -0,0 +1,140 @@
+package gfapi
+
+// This file includes the reading and writing of POSIX ACLs, which gluster
+// stores in the system.posix_acl_access extended attribute
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"syscall"
+)
+
+// aclXattr is the extended attribute holding the access ACL of a file.
+const aclXattr = "system.posix_acl_access"
+
+// aclVersion is the version of the xattr format of ACLs.
+const aclVersion = 2
+
+// aclUndefinedID is the qualifier of entries which have none.
+const aclUndefinedID = 0xffffffff
+
+// ACLTag is the type of an ACL entry
+type ACLTag uint16
+
+// ACLUserObj .. ACLOther are the ACL entry types, with the values of the
+// xattr format
+const (
+	ACLUserObj  ACLTag = 0x01 // the owner of the file
+	ACLUser     ACLTag = 0x02 // the user Qualifier
+	ACLGroupObj ACLTag = 0x04 // the group of the file
+	ACLGroup    ACLTag = 0x08 // the group Qualifier
+	ACLMask     ACLTag = 0x10 // the most ACLUser, ACLGroupObj and ACLGroup entries grant
+	ACLOther    ACLTag = 0x20 // everyone else
+)
+
+// ACLEntry is an entry of a POSIX ACL
+type ACLEntry struct {
+	Tag ACLTag
+	// Qualifier is the uid of ACLUser and the gid of ACLGroup entries, and
+	// unused by other entries.
+	Qualifier uint32
+	// Perms are the permission bits granted, 4 (read), 2 (write) and 1 (execute).
+	Perms uint16
+}
+
+// ACL is a POSIX access ACL
+type ACL struct {
+	Entries []ACLEntry
+}
+
+// GetACL returns the access ACL of path. If path has no extended ACL, the
+// minimal ACL equivalent to its permission bits is returned.
+//
+// Returns an error on failure
+func (v *Volume) GetACL(path string) (*ACL, error) {
+	value, err := v.GetxattrValue(path, aclXattr)
+	if errors.Is(err, ErrNoXattr) {
+		info, err := v.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		return aclFromMode(info.Mode()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	acl, err := decodeACL(value)
+	if err != nil {
+		return nil, &os.PathError{Op: "getacl", Path: path, Err: err}
+	}
+	return acl, nil
+}
+
+// SetACL sets the access ACL of path to acl, which must contain ACLUserObj,
+// ACLGroupObj and ACLOther entries, and an ACLMask entry if it has ACLUser or
+// ACLGroup entries. The entries may be in any order.
+//
+// Returns an error on failure
+func (v *Volume) SetACL(path string, acl *ACL) error {
+	if err := v.Setxattr(path, aclXattr, encodeACL(acl), 0); err != nil {
+		return &os.PathError{Op: "setacl", Path: path, Err: xattrError(aclXattr, err)}
+	}
+	v.invalidateStat(path)
+	return nil
+}
+
+// aclFromMode returns the minimal ACL equivalent to the permission bits of mode.
+func aclFromMode(mode os.FileMode) *ACL {
+	perm := uint16(mode.Perm())
+	return &ACL{Entries: []ACLEntry{
+		{Tag: ACLUserObj, Qualifier: aclUndefinedID, Perms: perm >> 6 & 7},
+		{Tag: ACLGroupObj, Qualifier: aclUndefinedID, Perms: perm >> 3 & 7},
+		{Tag: ACLOther, Qualifier: aclUndefinedID, Perms: perm & 7},
+	}}
+}
+
+// decodeACL decodes an ACL from the xattr format: a little endian 32 bit
+// version followed by entries of a 16 bit tag, 16 bit perms and 32 bit id.
+func decodeACL(b []byte) (*ACL, error) {
+	if len(b) < 4 || (len(b)-4)%8 != 0 || binary.LittleEndian.Uint32(b) != aclVersion {
+		return nil, fmt.Errorf("malformed %s xattr: %w", aclXattr, syscall.EINVAL)
+	}
+
+	acl := &ACL{Entries: make([]ACLEntry, 0, (len(b)-4)/8)}
+	for b = b[4:]; len(b) > 0; b = b[8:] {
+		acl.Entries = append(acl.Entries, ACLEntry{
+			Tag:       ACLTag(binary.LittleEndian.Uint16(b)),
+			Perms:     binary.LittleEndian.Uint16(b[2:]),
+			Qualifier: binary.LittleEndian.Uint32(b[4:]),
+		})
+	}
+	return acl, nil
+}
+
+// encodeACL encodes acl in the xattr format, with its entries sorted by tag
+// and qualifier as the bricks require.
+func encodeACL(acl *ACL) []byte {
+	entries := append([]ACLEntry(nil), acl.Entries...)
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Tag != entries[j].Tag {
+			return entries[i].Tag < entries[j].Tag
+		}
+		return entries[i].Qualifier < entries[j].Qualifier
+	})
+
+	b := binary.LittleEndian.AppendUint32(make([]byte, 0, 4+8*len(entries)), aclVersion)
+	for _, e := range entries {
+		id := e.Qualifier
+		if e.Tag != ACLUser && e.Tag != ACLGroup {
+			id = aclUndefinedID
+		}
+		b = binary.LittleEndian.AppendUint16(b, uint16(e.Tag))
+		b = binary.LittleEndian.AppendUint16(b, e.Perms)
+		b = binary.LittleEndian.AppendUint32(b, id)
+	}
+	return b
+}
@@ -0,0 +1,277 @@
+package gfapi
+
+// This file includes operations relative to an open directory, like the *at
+// calls in the 'syscall' package. They were added to gfapi in GlusterFS 11,
+// and return ErrUnsupported when the loaded library lacks them.
+
+// #cgo pkg-config: glusterfs-api
+// #include "glusterfs/api/glfs.h"
+// #include <stdlib.h>
+// #include <fcntl.h>
+// #include <sys/stat.h>
+//
+// typedef int (*readlinkat_fn)(glfs_fd_t *, const char *, char *, size_t);
+// typedef int (*linkat_fn)(glfs_fd_t *, const char *, glfs_fd_t *, const char *, int);
+// typedef int (*symlinkat_fn)(const char *, glfs_fd_t *, const char *);
+// typedef int (*unlinkat_fn)(glfs_fd_t *, const char *, int);
+// typedef int (*mkdirat_fn)(glfs_fd_t *, const char *, mode_t);
+// typedef int (*renameat_fn)(glfs_fd_t *, const char *, glfs_fd_t *, const char *);
+// typedef glfs_fd_t *(*openat_fn)(glfs_fd_t *, const char *, int, mode_t);
+// typedef int (*fstatat_fn)(glfs_fd_t *, const char *, struct stat *, int);
+//
+// static int call_readlinkat(void *fn, glfs_fd_t *fd, const char *path, char *buf, size_t size) {
+// 	return ((readlinkat_fn)fn)(fd, path, buf, size);
+// }
+//
+// static int call_linkat(void *fn, glfs_fd_t *oldfd, const char *oldpath, glfs_fd_t *newfd, const char *newpath, int flags) {
+// 	return ((linkat_fn)fn)(oldfd, oldpath, newfd, newpath, flags);
+// }
+//
+// static int call_symlinkat(void *fn, const char *target, glfs_fd_t *fd, const char *path) {
+// 	return ((symlinkat_fn)fn)(target, fd, path);
+// }
+//
+// static int call_unlinkat(void *fn, glfs_fd_t *fd, const char *path, int flags) {
+// 	return ((unlinkat_fn)fn)(fd, path, flags);
+// }
+//
+// static int call_mkdirat(void *fn, glfs_fd_t *fd, const char *path, mode_t mode) {
+// 	return ((mkdirat_fn)fn)(fd, path, mode);
+// }
+//
+// static int call_renameat(void *fn, glfs_fd_t *oldfd, const char *oldpath, glfs_fd_t *newfd, const char *newpath) {
+// 	return ((renameat_fn)fn)(oldfd, oldpath, newfd, newpath);
+// }
+//
+// static glfs_fd_t *call_openat(void *fn, glfs_fd_t *fd, const char *path, int flags, mode_t mode) {
+// 	return ((openat_fn)fn)(fd, path, flags, mode);
+// }
+//
+// static int call_fstatat(void *fn, glfs_fd_t *fd, const char *path, struct stat *stat, int flags) {
+// 	return ((fstatat_fn)fn)(fd, path, stat, flags);
+// }
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"syscall"
+	"unsafe"
+)
+
+// Flags for the operations relative to a directory.
+const (
+	// AT_REMOVEDIR makes Unlinkat remove a directory instead of a file.
+	AT_REMOVEDIR = C.AT_REMOVEDIR
+	// AT_SYMLINK_NOFOLLOW makes Statat describe a symbolic link itself
+	// rather than the file it refers to.
+	AT_SYMLINK_NOFOLLOW = C.AT_SYMLINK_NOFOLLOW
+	// AT_EMPTY_PATH makes Linkat link the file d itself when oldname is
+	// empty. It is only defined by fcntl.h with _GNU_SOURCE.
+	AT_EMPTY_PATH = 0x1000
+)
+
+// Statat returns an os.FileInfo object describing the entry name in the
+// directory d. With the AT_SYMLINK_NOFOLLOW flag it behaves like Lstat,
+// otherwise like Stat.
+//
+// Returns an error on failure
+func (d *File) Statat(name string, flags int) (os.FileInfo, error) {
+	fn := optionalFunc("glfs_fstatat")
+	if fn == nil {
+		return nil, &os.PathError{Op: "fstatat", Path: name, Err: ErrUnsupported}
+	}
+	if d.glfs.fd == nil {
+		return nil, &os.PathError{Op: "fstatat", Path: name, Err: os.ErrClosed}
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	var stat syscall.Stat_t
+	ret, err := C.call_fstatat(fn, d.glfs.fd, cname, (*C.struct_stat)(unsafe.Pointer(&stat)), C.int(flags))
+	if int(ret) < 0 {
+		return nil, &os.PathError{Op: "fstatat", Path: name, Err: err}
+	}
+	return fileInfoFromStat(&stat, name), nil
+}
+
+// Openat opens the entry name in the directory d, like OpenFile does for
+// paths. perm is used when flags contain O_CREATE. The File is treated as a
+// directory if flags contain O_DIRECTORY, and its name is name joined to the
+// name of d. O_CHMOD is not supported.
+//
+// Returns a File object on success and a os.PathError on failure.
+func (d *File) Openat(name string, flags int, perm os.FileMode) (*File, error) {
+	if flags&O_CHMOD != 0 {
+		return nil, &os.PathError{Op: "openat", Path: name, Err: fmt.Errorf("%w: Openat does not support O_CHMOD", ErrInvalidFlags)}
+	}
+	fn := featureFunc(FeatureOpenat)
+	if fn == nil {
+		return nil, &os.PathError{Op: "openat", Path: name, Err: ErrUnsupported}
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	cfd, err := C.call_openat(fn, d.glfs.fd, cname, C.int(flags), d.vol.createMode(perm))
+	if flags&(os.O_CREATE|os.O_TRUNC) != 0 {
+		d.invalidateChildStat(name)
+	}
+	if cfd == nil {
+		return nil, &os.PathError{Op: "openat", Path: name, Err: err}
+	}
+
+	return &File{
+		name:  path.Join(d.name, name),
+		glfs:  &Glfs{cfd},
+		isDir: flags&syscall.O_DIRECTORY != 0,
+		vol:   d.vol,
+	}, nil
+}
+
+// invalidateChildStat drops the Volume's cached Stat results for the entry name
+// in the directory d after it has been changed through d.
+func (d *File) invalidateChildStat(name string) {
+	if d.vol != nil {
+		d.vol.invalidateStat(path.Join(d.name, name))
+	}
+}
+
+// Readlinkat returns the destination of the symbolic link name, resolved
+// relative to the directory d rather than to the root of the volume.
+//
+// Returns an error on failure
+func (d *File) Readlinkat(name string) (string, error) {
+	fn := optionalFunc("glfs_readlinkat")
+	if fn == nil {
+		return "", &os.PathError{Op: "readlinkat", Path: name, Err: ErrUnsupported}
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	target, err := readlinkBuffer(func(buf []byte) (int, error) {
+		ret, err := C.call_readlinkat(fn, d.glfs.fd, cname, (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf)))
+		return int(ret), err
+	})
+	if err != nil {
+		return "", &os.PathError{Op: "readlinkat", Path: name, Err: err}
+	}
+	return target, nil
+}
+
+// Linkat creates newname in the directory newdir as a hard link to oldname
+// in the directory d. flags is passed on as in linkat(2).
+//
+// Returns an error on failure
+func (d *File) Linkat(oldname string, newdir *File, newname string, flags int) error {
+	fn := optionalFunc("glfs_linkat")
+	if fn == nil {
+		return &os.LinkError{Op: "linkat", Old: oldname, New: newname, Err: ErrUnsupported}
+	}
+
+	coldname := C.CString(oldname)
+	defer C.free(unsafe.Pointer(coldname))
+
+	cnewname := C.CString(newname)
+	defer C.free(unsafe.Pointer(cnewname))
+
+	ret, err := C.call_linkat(fn, d.glfs.fd, coldname, newdir.glfs.fd, cnewname, C.int(flags))
+	d.invalidateChildStat(oldname)
+	newdir.invalidateChildStat(newname)
+	if int(ret) < 0 {
+		return &os.LinkError{Op: "linkat", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+// Symlinkat creates linkname in the directory d as a symbolic link to target.
+//
+// Returns an error on failure
+func (d *File) Symlinkat(target, linkname string) error {
+	fn := optionalFunc("glfs_symlinkat")
+	if fn == nil {
+		return &os.LinkError{Op: "symlinkat", Old: target, New: linkname, Err: ErrUnsupported}
+	}
+
+	ctarget := C.CString(target)
+	defer C.free(unsafe.Pointer(ctarget))
+
+	clinkname := C.CString(linkname)
+	defer C.free(unsafe.Pointer(clinkname))
+
+	ret, err := C.call_symlinkat(fn, ctarget, d.glfs.fd, clinkname)
+	d.invalidateChildStat(linkname)
+	if int(ret) < 0 {
+		return &os.LinkError{Op: "symlinkat", Old: target, New: linkname, Err: err}
+	}
+	return nil
+}
+
+// Unlinkat removes the entry name from the directory d. With the AT_REMOVEDIR
+// flag it removes an empty directory, otherwise a file.
+//
+// Returns an error on failure
+func (d *File) Unlinkat(name string, flags int) error {
+	fn := optionalFunc("glfs_unlinkat")
+	if fn == nil {
+		return &os.PathError{Op: "unlinkat", Path: name, Err: ErrUnsupported}
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	ret, err := C.call_unlinkat(fn, d.glfs.fd, cname, C.int(flags))
+	d.invalidateChildStat(name)
+	if int(ret) < 0 {
+		return &os.PathError{Op: "unlinkat", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Mkdirat creates the directory name in the directory d with the permission bits perm.
+//
+// Returns an error on failure
+func (d *File) Mkdirat(name string, perm os.FileMode) error {
+	fn := optionalFunc("glfs_mkdirat")
+	if fn == nil {
+		return &os.PathError{Op: "mkdirat", Path: name, Err: ErrUnsupported}
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	ret, err := C.call_mkdirat(fn, d.glfs.fd, cname, d.vol.createMode(perm))
+	d.invalidateChildStat(name)
+	if int(ret) < 0 {
+		return &os.PathError{Op: "mkdirat", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Renameat renames the entry oldname in the directory olddir to newname in
+// the directory newdir, replacing any existing newname like Rename.
+//
+// Returns an error on failure
+func (olddir *File) Renameat(oldname string, newdir *File, newname string) error {
+	fn := optionalFunc("glfs_renameat")
+	if fn == nil {
+		return &os.LinkError{Op: "renameat", Old: oldname, New: newname, Err: ErrUnsupported}
+	}
+
+	coldname := C.CString(oldname)
+	defer C.free(unsafe.Pointer(coldname))
+
+	cnewname := C.CString(newname)
+	defer C.free(unsafe.Pointer(cnewname))
+
+	ret, err := C.call_renameat(fn, olddir.glfs.fd, coldname, newdir.glfs.fd, cnewname)
+	olddir.invalidateChildStat(oldname)
+	newdir.invalidateChildStat(newname)
+	if int(ret) < 0 {
+		return &os.LinkError{Op: "renameat", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
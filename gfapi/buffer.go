@@ -0,0 +1,85 @@
+package gfapi
+
+// This file includes the pools of buffers shared by the helpers that copy data
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultBufferSize is the size of the pooled copy buffers unless changed
+// with SetBufferSize.
+const defaultBufferSize = 128 << 10
+
+// minBufferSize is the smallest size SetBufferSize accepts.
+const minBufferSize = 4 << 10
+
+// bufferPool is a pool of copy buffers of a single size, which can be
+// changed while buffers are in use.
+type bufferPool struct {
+	size atomic.Int64
+	pool sync.Pool
+}
+
+func newBufferPool(size int) *bufferPool {
+	p := &bufferPool{}
+	p.setSize(size)
+	return p
+}
+
+// buffers is the pool of the package, sized by SetBufferSize, which is used
+// unless a Volume has a pool of its own, see Volume.SetIOBufferSize.
+var buffers = newBufferPool(defaultBufferSize)
+
+// SetBufferSize sets the size of the buffers the copying helpers, such as
+// CopyFile, TarTo and UntarFrom, move data through. The buffers are pooled
+// across calls and goroutines. Larger buffers mean fewer round trips for
+// large files, at the cost of memory for each copy in progress.
+// Sizes below 4 KiB are raised to 4 KiB; the default is 128 KiB.
+// Volume.SetIOBufferSize overrides the size for a single Volume.
+//
+// Buffers of the previous size still in use are dropped when returned.
+func SetBufferSize(n int) {
+	buffers.setSize(n)
+}
+
+// setSize sets the size of the buffers of the pool to n, or the minimum.
+func (p *bufferPool) setSize(n int) {
+	p.size.Store(int64(max(n, minBufferSize)))
+}
+
+// get returns a buffer of the current size from the pool, which should be
+// returned with put once done with.
+func (p *bufferPool) get() *[]byte {
+	size := int(p.size.Load())
+	if buf, ok := p.pool.Get().(*[]byte); ok && len(*buf) == size {
+		return buf
+	}
+	buf := make([]byte, size)
+	return &buf
+}
+
+// put returns buf to the pool, unless the size has changed since it was taken.
+func (p *bufferPool) put(buf *[]byte) {
+	if len(*buf) == int(p.size.Load()) {
+		p.pool.Put(buf)
+	}
+}
+
+// copy is io.Copy through a buffer of the pool.
+func (p *bufferPool) copy(dst io.Writer, src io.Reader) (int64, error) {
+	buf := p.get()
+	defer p.put(buf)
+
+	return io.CopyBuffer(dst, src, *buf)
+}
+
+// copyN is io.CopyN through a buffer of the pool.
+func (p *bufferPool) copyN(dst io.Writer, src io.Reader, n int64) (int64, error) {
+	written, err := p.copy(dst, io.LimitReader(src, n))
+	if written < n && err == nil {
+		err = io.EOF
+	}
+	return written, err
+}
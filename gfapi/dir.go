@@ -0,0 +1,69 @@
+package gfapi
+
+// This file includes the Dir type, a File restricted to directory operations
+
+import (
+	"io/fs"
+	"os"
+)
+
+// Dir is an open directory. Unlike a File opened on a directory, it only has
+// the operations that make sense for directories, so that calling Read,
+// Write and the like on it is a compile error.
+type Dir struct {
+	f *File
+}
+
+// OpenDirTyped opens the named directory on the Volume v, like OpenDir, but
+// returns it as a Dir.
+//
+// Returns a Dir on success and an *os.PathError on failure, which wraps
+// syscall.ENOTDIR if name is not a directory
+func (v *Volume) OpenDirTyped(name string) (*Dir, error) {
+	f, err := v.OpenDir(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Dir{f: f}, nil
+}
+
+// Name returns the name of the directory as passed to OpenDirTyped.
+func (d *Dir) Name() string {
+	return d.f.Name()
+}
+
+// ReadDir reads up to n entries of the directory, see File.ReadDir.
+func (d *Dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	return d.f.ReadDir(n)
+}
+
+// Readdirnames reads up to n names of entries of the directory, see
+// File.Readdirnames.
+func (d *Dir) Readdirnames(n int) ([]string, error) {
+	return d.f.Readdirnames(n)
+}
+
+// Telldir returns the current position in the directory, see File.Telldir.
+func (d *Dir) Telldir() (int64, error) {
+	return d.f.Telldir()
+}
+
+// Seekdir sets the position in the directory to offset, which must have been
+// returned by Telldir.
+func (d *Dir) Seekdir(offset int64) {
+	d.f.Seekdir(offset)
+}
+
+// Stat returns an os.FileInfo describing the directory.
+//
+// Returns an error on failure
+func (d *Dir) Stat() (os.FileInfo, error) {
+	return d.f.Stat()
+}
+
+// Close closes the directory.
+//
+// Returns an *os.PathError on failure
+func (d *Dir) Close() error {
+	return d.f.Close()
+}
@@ -0,0 +1,42 @@
+package gfapi
+
+// This file includes the errors returned by the package
+
+import (
+	"errors"
+)
+
+var (
+	// ErrNegativeOffset is returned by the positional I/O operations when
+	// they are given an offset before the start of the file.
+	ErrNegativeOffset = errors.New("negative offset")
+
+	// ErrNegativeSize is returned when truncating a file to a negative size.
+	ErrNegativeSize = errors.New("negative size")
+
+	// ErrBufferTooLarge is returned when a buffer is too large for the number
+	// of bytes transferred to be reported back without overflowing.
+	ErrBufferTooLarge = errors.New("buffer too large")
+
+	// ErrUnsupported is returned by the wrappers of optional libgfapi calls
+	// when the loaded library does not provide them. See Supports.
+	ErrUnsupported = errors.ErrUnsupported
+
+	// ErrNotMounted is returned by the operations of a Volume that has not
+	// been mounted yet, or has been unmounted.
+	ErrNotMounted = errors.New("volume not mounted")
+
+	// ErrNoXattr is returned when reading an extended attribute that is not
+	// set.
+	ErrNoXattr = errors.New("no such extended attribute")
+
+	// ErrXattrPermission is returned when reading or writing an extended
+	// attribute is denied, see xattrError.
+	ErrXattrPermission = errors.New("extended attribute access denied")
+
+	// ErrInvalidFlags is returned by OpenFile when given contradictory flags,
+	// see checkOpenFlags.
+	ErrInvalidFlags = errors.New("invalid open flags")
+
+	errBadQuotaXattr = errors.New("malformed quota xattr")
+)
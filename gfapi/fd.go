@@ -4,6 +4,7 @@ import "C"
 import (
 	"fmt"
 	"os"
+	"runtime"
 	"syscall"
 	"unsafe"
 )
@@ -15,6 +16,8 @@ import (
 // #include <stdlib.h>
 // #include <sys/stat.h>
 // #include <dirent.h>
+// #include <limits.h>
+// #include <sys/uio.h>
 import "C"
 
 // Fd is the glusterfs fd type
@@ -33,22 +36,27 @@ func (fd *Glfs) Fchmod(mode uint32) error {
 	return err
 }
 
-// Fchown changes the uid and gid of the Fd
+// Fchown changes the uid and gid of the Fd.
+// A uid or gid of 0xffffffff, that is (uid_t)-1, leaves that id unchanged.
 //
 // Returns error on failure
 func (fd *Glfs) Fchown(uid, gid uint32) error {
-	_, err := C.glfs_fchown(fd.fd, C.uid_t(uid), C.gid_t(gid))
-
-	return err
+	ret, err := C.glfs_fchown(fd.fd, C.uid_t(uid), C.gid_t(gid))
+	if int(ret) < 0 {
+		return err
+	}
+	return nil
 }
 
 // Futimens changes the atime and mtime of the Fd
 //
 // Returns error on failure
 func (fd *Glfs) Futimens(times [2]C.struct_timespec) error {
-	_, err := C.glfs_futimens(fd.fd, &times[0])
-
-	return err
+	ret, err := C.glfs_futimens(fd.fd, &times[0])
+	if ret < 0 {
+		return err
+	}
+	return nil
 }
 
 // Fstat performs an fstat call on the Fd and saves stat details in the passed stat structure
@@ -73,31 +81,153 @@ func (fd *Glfs) Fsync() error {
 	return nil
 }
 
+// Fdatasync performs an fdatasync on the Fd, which unlike Fsync does not
+// wait for metadata that is not needed to read the data back
+//
+// Returns error on failure
+func (fd *Glfs) Fdatasync() error {
+	ret, err := C.glfs_fdatasync(fd.fd, nil, nil)
+	if ret < 0 {
+		return err
+	}
+	return nil
+}
+
 // Ftruncate truncates the size of the Fd to the given size
 //
 // Returns error on failure
 func (fd *Glfs) Ftruncate(size int64) error {
-	_, err := C.glfs_ftruncate(fd.fd, C.off_t(size), nil, nil)
+	if size < 0 {
+		return ErrNegativeSize
+	}
 
-	return err
+	ret, err := C.glfs_ftruncate(fd.fd, C.off_t(size), nil, nil)
+	if int(ret) < 0 {
+		return err
+	}
+	return nil
+}
+
+// checkPositional validates the arguments of a positional read or write.
+// The byte count comes back from glfs as a ssize_t, so a buffer longer than
+// SSIZE_MAX could not be reported without overflowing int on 32-bit platforms.
+func checkPositional(b []byte, off int64) error {
+	if off < 0 {
+		return ErrNegativeOffset
+	}
+	if uint64(len(b)) > uint64(C.SSIZE_MAX) {
+		return ErrBufferTooLarge
+	}
+	return nil
+}
+
+// ioCount converts the ssize_t ret returned by a read or write of at most max
+// bytes, with errno err, to a byte count. A negative ret is an error, and is
+// never returned as a count, and so is a ret larger than max, which could
+// otherwise overflow an int on 32 bit platforms.
+func ioCount(ret int64, err error, max int) (int, error) {
+	if ret < 0 {
+		if err == nil {
+			err = syscall.EIO
+		}
+		return 0, err
+	}
+	if ret > int64(max) {
+		return 0, fmt.Errorf("gfapi returned byte count %d for at most %d bytes: %w", ret, max, syscall.EIO)
+	}
+	return int(ret), nil
 }
 
 // Pread reads at most len(b) bytes into b from offset off in Fd
 //
 // Returns number of bytes read on success and error on failure
 func (fd *Glfs) Pread(b []byte, off int64) (int, error) {
-	n, err := C.glfs_pread(fd.fd, unsafe.Pointer(&b[0]), C.size_t(len(b)), C.off_t(off), 0, nil)
+	if err := checkPositional(b, off); err != nil {
+		return 0, err
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
 
-	return int(n), err
+	n, err := C.glfs_pread(fd.fd, unsafe.Pointer(&b[0]), C.size_t(len(b)), C.off_t(off), 0, nil)
+	return ioCount(int64(n), err, len(b))
 }
 
 // Pwrite writes len(b) bytes from b into the Fd from offset off
 //
 // Returns number of bytes written on success and error on failure
 func (fd *Glfs) Pwrite(b []byte, off int64) (int, error) {
+	if err := checkPositional(b, off); err != nil {
+		return 0, err
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
 	n, err := C.glfs_pwrite(fd.fd, unsafe.Pointer(&b[0]), C.size_t(len(b)), C.off_t(off), 0, nil, nil)
+	return ioCount(int64(n), err, len(b))
+}
 
-	return int(n), err
+// iovecs builds the iovecs of the non-empty buffers in bufs for preadv and
+// pwritev at offset off, pinning the buffers with pinner as the iovecs point
+// to them. It also returns the total length of the buffers.
+func iovecs(bufs [][]byte, off int64, pinner *runtime.Pinner) ([]C.struct_iovec, int, error) {
+	if off < 0 {
+		return nil, 0, ErrNegativeOffset
+	}
+
+	var total uint64
+	iov := make([]C.struct_iovec, 0, len(bufs))
+	for _, b := range bufs {
+		if len(b) == 0 {
+			continue
+		}
+		total += uint64(len(b))
+		if total > uint64(C.SSIZE_MAX) {
+			return nil, 0, ErrBufferTooLarge
+		}
+		pinner.Pin(&b[0])
+		iov = append(iov, C.struct_iovec{iov_base: unsafe.Pointer(&b[0]), iov_len: C.size_t(len(b))})
+	}
+	return iov, int(total), nil
+}
+
+// Preadv reads into the buffers in bufs in turn from the Fd from offset off
+//
+// Returns number of bytes read on success and error on failure
+func (fd *Glfs) Preadv(bufs [][]byte, off int64) (int, error) {
+	var pinner runtime.Pinner
+	defer pinner.Unpin()
+
+	iov, total, err := iovecs(bufs, off, &pinner)
+	if err != nil {
+		return 0, err
+	}
+	if len(iov) == 0 {
+		return 0, nil
+	}
+
+	n, err := C.glfs_preadv(fd.fd, &iov[0], C.int(len(iov)), C.off_t(off), 0)
+	return ioCount(int64(n), err, total)
+}
+
+// Pwritev writes the buffers in bufs in turn into the Fd from offset off
+//
+// Returns number of bytes written on success and error on failure
+func (fd *Glfs) Pwritev(bufs [][]byte, off int64) (int, error) {
+	var pinner runtime.Pinner
+	defer pinner.Unpin()
+
+	iov, total, err := iovecs(bufs, off, &pinner)
+	if err != nil {
+		return 0, err
+	}
+	if len(iov) == 0 {
+		return 0, nil
+	}
+
+	n, err := C.glfs_pwritev(fd.fd, &iov[0], C.int(len(iov)), C.off_t(off), 0)
+	return ioCount(int64(n), err, total)
 }
 
 // Read reads at most len(b) bytes into b from Fd
@@ -112,16 +242,15 @@ func (fd *Glfs) Read(b []byte) (n int, err error) {
 		p0 = unsafe.Pointer(&_zero)
 	}
 
+	if uint64(len(b)) > uint64(C.SSIZE_MAX) {
+		return 0, ErrBufferTooLarge
+	}
+
 	// glfs_read returns a ssize_t. The value of which is the number of bytes written.
 	// Unless, ret is -1, an error, implying to check errno. cgo collects errno as the
 	// functions error return value.
 	ret, e1 := C.glfs_read(fd.fd, p0, C.size_t(len(b)), 0)
-	n = int(ret)
-	if n < 0 {
-		err = e1
-	}
-
-	return n, err
+	return ioCount(int64(ret), e1, len(b))
 }
 
 // Write writes len(b) bytes from b into the Fd
@@ -136,22 +265,47 @@ func (fd *Glfs) Write(b []byte) (n int, err error) {
 		p0 = unsafe.Pointer(&_zero)
 	}
 
+	if uint64(len(b)) > uint64(C.SSIZE_MAX) {
+		return 0, ErrBufferTooLarge
+	}
+
 	// glfs_write returns a ssize_t. The value of which is the number of bytes written.
 	// Unless, ret is -1, an error, implying to check errno. cgo collects errno as the
 	// functions error return value.
 	ret, e1 := C.glfs_write(fd.fd, p0, C.size_t(len(b)), 0)
-	n = int(ret)
-	if n < 0 {
-		err = e1
+	return ioCount(int64(ret), e1, len(b))
+}
+
+// Dup duplicates the Fd. The new Fd refers to the same open file but keeps
+// its own offset.
+//
+// Returns the new Fd on success and error on failure
+func (fd *Glfs) Dup() (*Glfs, error) {
+	cfd, err := C.glfs_dup(fd.fd)
+	if cfd == nil {
+		return nil, err
 	}
+	return &Glfs{cfd}, nil
+}
 
-	return n, err
+// Fchdir changes the current working directory of the Fd's volume to the
+// directory the Fd is open on
+//
+// Returns error on failure
+func (fd *Glfs) Fchdir() error {
+	ret, err := C.glfs_fchdir(fd.fd)
+	if ret < 0 {
+		return err
+	}
+	return nil
 }
 
 func (fd *Glfs) lseek(offset int64, whence int) (int64, error) {
 	ret, err := C.glfs_lseek(fd.fd, C.off_t(offset), C.int(whence))
-
-	return int64(ret), err
+	if ret < 0 {
+		return -1, err
+	}
+	return int64(ret), nil
 }
 
 func (fd *Glfs) Fallocate(mode int, offset int64, len int64) error {
@@ -164,6 +318,19 @@ func (fd *Glfs) Fallocate(mode int, offset int64, len int64) error {
 	return err
 }
 
+// Zerofill writes zeros to the length bytes of the Fd starting at offset,
+// allocating the space on the bricks, where possible without writing the
+// zeros out
+//
+// Returns error on failure
+func (fd *Glfs) Zerofill(offset, length int64) error {
+	ret, err := C.glfs_zerofill(fd.fd, C.off_t(offset), C.off_t(length))
+	if int(ret) < 0 {
+		return err
+	}
+	return nil
+}
+
 func (fd *Glfs) Fgetxattr(attr string, dest []byte) (int64, error) {
 	var ret C.ssize_t
 	var err error
@@ -190,8 +357,13 @@ func (fd *Glfs) Fsetxattr(attr string, data []byte, flags int) error {
 	cattr := C.CString(attr)
 	defer C.free(unsafe.Pointer(cattr))
 
+	var value unsafe.Pointer
+	if len(data) > 0 {
+		value = unsafe.Pointer(&data[0])
+	}
+
 	ret, err := C.glfs_fsetxattr(fd.fd, cattr,
-		unsafe.Pointer(&data[0]), C.size_t(len(data)),
+		value, C.size_t(len(data)),
 		C.int(flags))
 
 	if ret == 0 {
@@ -281,6 +453,40 @@ func (fd *Glfs) ReaddirR(n int) ([]os.FileInfo, error) {
 	return files, nil
 }
 
+// readdirType reads the next directory entry and returns its name and type
+// bits. At the end of the directory the name is empty.
+func (fd *Glfs) readdirType() (string, os.FileMode, error) {
+	d, err := C.glfs_readdir(fd.fd)
+	if err != nil {
+		return "", 0, err
+	}
+
+	dirent := (*syscall.Dirent)(unsafe.Pointer(d))
+	if dirent == nil {
+		return "", 0, nil
+	}
+
+	return direntName(dirent), direntType(dirent), nil
+}
+
+// Telldir returns the current position in the directory stream of the Fd,
+// which can be passed to Seekdir later to read on from there
+//
+// Returns error on failure
+func (fd *Glfs) Telldir() (int64, error) {
+	ret, err := C.glfs_telldir(fd.fd)
+	if ret < 0 {
+		return -1, err
+	}
+	return int64(ret), nil
+}
+
+// Seekdir sets the position in the directory stream of the Fd to offset,
+// which must have been returned by Telldir
+func (fd *Glfs) Seekdir(offset int64) {
+	C.glfs_seekdir(fd.fd, C.long(offset))
+}
+
 // Readdirnames returns the names of files in a directory.
 //
 // n is the maximum number of items to return and works the same way as Readdir.
@@ -0,0 +1,60 @@
+package gfapi
+
+// This file includes the detection of optional libgfapi features. Calls that
+// are missing from older libraries are resolved at runtime rather than linked
+// against, so that the package still loads on those libraries.
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// Optional features which may be missing from the loaded libgfapi.
+// FeatureOpenat covers the whole family of calls relative to a directory fd
+// (openat, mkdirat, readlinkat, ...), which were added together.
+const (
+	FeatureCopyFileRange      = "copy_file_range"
+	FeatureOpenat             = "openat"
+	FeatureUnsetVolfileServer = "unset_volfile_server"
+	FeatureUpcall             = "upcall"
+)
+
+// featureSymbols maps each optional feature to the libgfapi call providing it.
+var featureSymbols = map[string]string{
+	FeatureCopyFileRange:      "glfs_copy_file_range",
+	FeatureOpenat:             "glfs_openat",
+	FeatureUnsetVolfileServer: "glfs_unset_volfile_server",
+	FeatureUpcall:             "glfs_upcall_register",
+}
+
+// optionalFuncs caches the addresses of optional libgfapi calls by symbol.
+var optionalFuncs sync.Map
+
+// optionalFunc returns the address of the optional libgfapi call symbol, or
+// nil if the loaded library lacks it. Each symbol is looked up only once.
+func optionalFunc(symbol string) unsafe.Pointer {
+	if fn, ok := optionalFuncs.Load(symbol); ok {
+		return fn.(unsafe.Pointer)
+	}
+	fn := lookupSymbol(symbol)
+	optionalFuncs.Store(symbol, fn)
+	return fn
+}
+
+// featureFunc returns the address of the libgfapi call providing feature,
+// or nil if the loaded library lacks it.
+func featureFunc(feature string) unsafe.Pointer {
+	symbol, ok := featureSymbols[feature]
+	if !ok {
+		return nil
+	}
+	return optionalFunc(symbol)
+}
+
+// Supports reports whether the loaded libgfapi provides the optional feature,
+// one of the Feature constants. Unknown features are reported as unsupported.
+//
+// Operations relying on an unsupported feature return ErrUnsupported.
+func Supports(feature string) bool {
+	return featureFunc(feature) != nil
+}
@@ -9,9 +9,14 @@ package gfapi
 import "C"
 
 import (
+	"bufio"
 	"errors"
+	"hash"
 	"io"
+	"io/fs"
 	"os"
+	"path"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -21,6 +26,17 @@ type File struct {
 	name  string
 	glfs  *Glfs
 	isDir bool
+
+	// vol is the Volume the file was opened from, if known.
+	vol *Volume
+
+	// pathOnly is set for files opened with O_PATH, which refuse I/O.
+	pathOnly bool
+
+	// statInfo is the result of StatCached, until the file is changed
+	// through f.
+	statMu   sync.Mutex
+	statInfo os.FileInfo
 }
 
 func NewFile(name string, glfs *Glfs, isDir bool) *File {
@@ -30,16 +46,33 @@ func NewFile(name string, glfs *Glfs, isDir bool) *File {
 // Close closes an open File.
 // Close is similar to os.Close in its functioning.
 //
-// Returns an Error on failure.
+// Returns an *os.PathError on failure, wrapping os.ErrClosed if the File is
+// already closed.
 func (f *File) Close() error {
+	if err := closeFile(f); err != nil {
+		return &os.PathError{Op: "close", Path: f.name, Err: err}
+	}
+	return nil
+}
+
+// closeFile closes a File for Close, and can be replaced in tests.
+var closeFile = (*File).close
+
+func (f *File) close() error {
 	var err error
 	var ret C.int
 
+	if f.glfs.fd == nil {
+		return os.ErrClosed
+	}
+
 	if f.isDir {
 		ret, err = C.glfs_closedir(f.glfs.fd)
 	} else {
 		ret, err = C.glfs_close(f.glfs.fd)
 	}
+	// gfapi releases the fd even if closing it fails.
+	f.glfs.fd = nil
 	if ret < 0 {
 		return err
 	}
@@ -47,28 +80,135 @@ func (f *File) Close() error {
 	return nil
 }
 
-// Chdir has not been implemented yet
+// CloseOnExec reports whether the file is closed when the process execs,
+// which is always the case. A glfs fd is not a kernel file descriptor but an
+// object in the memory of the process, which exec discards, so it cannot be
+// inherited by an exec'd helper. The connections to the bricks are owned by
+// gfapi and are not affected by the File.
+func (f *File) CloseOnExec() bool {
+	return true
+}
+
+// SetCloseOnExec sets whether the file is closed when the process execs,
+// like setting FD_CLOEXEC with fcntl. As a glfs fd never survives exec, see
+// CloseOnExec, setting it is a no-op.
+//
+// Returns an *os.PathError wrapping syscall.ENOTSUP when asked to keep the
+// file open across exec, and one wrapping os.ErrClosed if the File is closed
+func (f *File) SetCloseOnExec(on bool) error {
+	if f.glfs.fd == nil {
+		return &os.PathError{Op: "fcntl", Path: f.name, Err: os.ErrClosed}
+	}
+	if !on {
+		return &os.PathError{Op: "fcntl", Path: f.name, Err: syscall.ENOTSUP}
+	}
+	return nil
+}
+
+// Chdir changes the current working directory of the Volume the file was
+// opened from to the file, which must be a directory. See Volume.Chdir.
+//
+// Returns an error on failure
 func (f *File) Chdir() error {
-	return errors.New("Chdir has not been implemented yet")
+	if err := f.glfs.Fchdir(); err != nil {
+		return &os.PathError{Op: "chdir", Path: f.name, Err: err}
+	}
+	if f.vol != nil {
+		f.vol.clearStatCache()
+	}
+	return nil
+}
+
+// AbsName returns the absolute path of the file, with symbolic links
+// resolved, by resolving its name against the current working directory of
+// the Volume it was opened from. A relative name is therefore only resolved
+// correctly while the working directory is the one the file was opened in.
+//
+// Returns an error on failure
+func (f *File) AbsName() (string, error) {
+	if f.vol == nil {
+		return "", &os.PathError{Op: "realpath", Path: f.name, Err: errors.New("file not opened from a Volume")}
+	}
+	return f.vol.Realpath(f.name)
+}
+
+// Materialize gives the unnamed file opened with O_TMPFILE the name name, by
+// linking it into place with Linkat and AT_EMPTY_PATH. The name must not
+// exist yet. Once materialized, the file keeps its data when closed, and the
+// File is known by name.
+//
+// Returns an *os.LinkError wrapping syscall.ENOTSUP if the loaded libgfapi
+// or the volume cannot link a file by its fd, and an error on failure
+func (f *File) Materialize(name string) error {
+	if f.vol == nil {
+		return &os.LinkError{Op: "materialize", Old: f.name, New: name, Err: errors.New("file not opened from a Volume")}
+	}
+
+	dir, err := f.vol.OpenDir(path.Dir(name))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	err = f.Linkat("", dir, path.Base(name), AT_EMPTY_PATH)
+	if err != nil {
+		err = err.(*os.LinkError).Err
+		if err == ErrUnsupported || err == syscall.EINVAL || err == syscall.EOPNOTSUPP {
+			err = syscall.ENOTSUP
+		}
+		return &os.LinkError{Op: "materialize", Old: f.name, New: name, Err: err}
+	}
+
+	f.name = name
+	f.invalidateStat()
+	return nil
 }
 
 // Chmod changes the mode of the file to the given mode
 //
 // Returns an error on failure
 func (f *File) Chmod(mode os.FileMode) error {
+	defer f.invalidateStat()
 	return f.glfs.Fchmod(posixMode(mode))
 }
 
-// Chown has not been implemented yet
+// Chown changes the uid and gid of the file.
+// A uid or gid of -1 leaves that id unchanged.
+//
+// Returns an error on failure
 func (f *File) Chown(uid, gid int) error {
+	defer f.invalidateStat()
+	// -1 converts to 0xffffffff, the (uid_t)-1 fchown leaves unchanged
 	return f.glfs.Fchown(uint32(uid), uint32(gid))
 }
 
+// Futimens changes the atime and mtime of the file. Either time may be
+// TimeOmit to leave it unchanged, or TimeNow to set it to the current time.
+//
+// Returns an error on failure
 func (f *File) Futimens(atime, mtime time.Time) error {
-	var times [2]C.struct_timespec
-	times[0] = C.struct_timespec{tv_sec: C.long(atime.Unix()), tv_nsec: C.long(atime.Nanosecond())}
-	times[1] = C.struct_timespec{tv_sec: C.long(mtime.Unix()), tv_nsec: C.long(mtime.Nanosecond())}
-	return f.glfs.Futimens(times)
+	defer f.invalidateStat()
+	return f.glfs.Futimens(timespecs(atime, mtime))
+}
+
+// Chtimes changes the access and modification times of the file, like
+// os.Chtimes does for a named file
+//
+// Returns an error on failure
+func (f *File) Chtimes(atime, mtime time.Time) error {
+	if err := f.Futimens(atime, mtime); err != nil {
+		return &os.PathError{Op: "chtimes", Path: f.name, Err: err}
+	}
+	return nil
+}
+
+// checkIO returns an *os.PathError for op wrapping syscall.EBADF if the file
+// was opened with O_PATH, and so cannot be read or written.
+func (f *File) checkIO(op string) error {
+	if f.pathOnly {
+		return &os.PathError{Op: op, Path: f.name, Err: syscall.EBADF}
+	}
+	return nil
 }
 
 // Name returns the name of the opened file
@@ -83,6 +223,9 @@ func (f *File) Read(b []byte) (n int, err error) {
 	if f == nil {
 		return 0, os.ErrInvalid
 	}
+	if err := f.checkIO("read"); err != nil {
+		return 0, err
+	}
 	n, e := f.glfs.Read(b)
 	if n == 0 && len(b) > 0 && e == nil {
 		return 0, io.EOF
@@ -93,11 +236,120 @@ func (f *File) Read(b []byte) (n int, err error) {
 	return n, err
 }
 
-// ReadAt reads atmost len(b) bytes into b starting from offset off
+// ReadAll reads from the file until EOF and returns the data read.
+// The buffer is sized from the size of the file up front, so that it only
+// needs to grow if the file grows while being read.
+//
+// Returns the data read and an error if any, but not io.EOF.
+//
+// Based on the implementation of os.ReadFile in the Go source
+func (f *File) ReadAll() ([]byte, error) {
+	var size int
+	if size64, err := f.Size(); err == nil && int64(int(size64)) == size64 {
+		size = int(size64)
+	}
+	size++ // one byte for the final read at EOF
+
+	// If a file claims a small size, read at least 512 bytes.
+	if size < 512 {
+		size = 512
+	}
+
+	data := make([]byte, 0, size)
+	for {
+		n, err := f.Read(data[len(data):cap(data)])
+		data = data[:len(data)+n]
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return data, err
+		}
+
+		if len(data) >= cap(data) {
+			d := append(data[:cap(data)], 0)
+			data = d[:len(data)]
+		}
+	}
+}
+
+// defaultSequentialBufSize is the read size of SequentialReader if none is given.
+const defaultSequentialBufSize = 1 << 20
+
+// Checksum reads from the file until EOF and writes the data read to h,
+// through a pooled buffer, see Volume.SetIOBufferSize. The digest is left in
+// h for the caller to Sum.
+//
+// Returns the number of bytes read and an error if any, but not io.EOF.
+func (f *File) Checksum(h hash.Hash) (int64, error) {
+	return f.vol.ioBuffers().copy(h, f)
+}
+
+// SequentialReader returns a reader that reads the file from its current
+// offset in reads of bufSize bytes, or of 1 MiB if bufSize <= 0, however
+// little each call to its Read asks for. Streaming a large file through it
+// takes far fewer cgo calls and round trips than small reads on the File.
+//
+// gfapi has no posix_fadvise, so no readahead hint is given: readahead is
+// left to the volume's read-ahead translator.
+func (f *File) SequentialReader(bufSize int) io.Reader {
+	return sequentialReader(f, bufSize)
+}
+
+// sequentialReader buffers r in reads of bufSize bytes. The bufio.Reader is
+// wrapped so that only Read is exposed: otherwise io.Copy would use its
+// WriteTo, which hands r itself to destinations implementing io.ReaderFrom,
+// bypassing the buffer.
+func sequentialReader(r io.Reader, bufSize int) io.Reader {
+	if bufSize <= 0 {
+		bufSize = defaultSequentialBufSize
+	}
+	return struct{ io.Reader }{bufio.NewReaderSize(r, bufSize)}
+}
+
+// ReadAt reads len(b) bytes into b starting from offset off. Like
+// os.File.ReadAt, it keeps reading until b is full, and returns io.EOF along
+// with the number of bytes read if the end of the file is reached first, that
+// is whenever it reads fewer than len(b) bytes, including none at all because
+// off is at or beyond the end. Filling b exactly up to the last byte returns
+// a nil error.
 //
 // Returns number of bytes read and an error if any
-func (f *File) ReadAt(b []byte, off int64) (int, error) {
-	return f.glfs.Pread(b, off)
+func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, ErrNegativeOffset
+	}
+	if err := f.checkIO("read"); err != nil {
+		return 0, err
+	}
+
+	for len(b) > 0 {
+		m, e := f.glfs.Pread(b, off)
+		if e != nil {
+			return n, e
+		}
+		if m == 0 {
+			return n, io.EOF
+		}
+		n += m
+		b = b[m:]
+		off += int64(m)
+	}
+	return n, nil
+}
+
+// NewReaderAt returns an io.ReaderAt reading from a duplicate of the file's fd,
+// so that its reads never disturb the offset used by Read and Write.
+// The reader also implements io.Closer, which must be called to release the
+// duplicate fd.
+//
+// Returns an error on failure
+func (f *File) NewReaderAt() (io.ReaderAt, error) {
+	dup, err := f.glfs.Dup()
+	if err != nil {
+		return nil, &os.PathError{Op: "dup", Path: f.name, Err: err}
+	}
+	return &File{name: f.name, glfs: dup, vol: f.vol}, nil
 }
 
 // Readdir returns the information of files in a directory.
@@ -113,6 +365,57 @@ func (f *File) ReaddirR(n int) ([]os.FileInfo, error) {
 	return f.glfs.ReaddirR(n)
 }
 
+// ReadDir reads the directory and returns its entries, like os.File.ReadDir.
+// The entries "." and ".." are skipped.
+//
+// If n > 0, ReadDir returns at most n entries and io.EOF once the end of the
+// directory has been reached. If n <= 0, ReadDir returns all the remaining entries.
+//
+// Info on the returned entries stats them relative to the directory rather
+// than by their full path, so the directory should be kept open until done
+// with the entries.
+func (f *File) ReadDir(n int) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+
+	for n <= 0 || len(entries) < n {
+		name, typ, err := f.glfs.readdirType()
+		if err != nil {
+			return entries, &os.PathError{Op: "readdir", Path: f.name, Err: err}
+		}
+		if name == "" {
+			break
+		}
+		if name == "." || name == ".." {
+			continue
+		}
+		entries = append(entries, &dirEntry{dir: f, name: name, typ: typ})
+	}
+
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+	return entries, nil
+}
+
+// Telldir returns the current position in the directory, which can be passed
+// to Seekdir later, even on another File open on the same directory, to read
+// on from there.
+//
+// Returns an error on failure
+func (f *File) Telldir() (int64, error) {
+	off, err := f.glfs.Telldir()
+	if err != nil {
+		return -1, &os.PathError{Op: "telldir", Path: f.name, Err: err}
+	}
+	return off, nil
+}
+
+// Seekdir sets the position in the directory to offset, which must have been
+// returned by Telldir.
+func (f *File) Seekdir(offset int64) {
+	f.glfs.Seekdir(offset)
+}
+
 // Readdirnames returns the names of files in a directory.
 //
 // n is the maximum number of items to return and works the same way as Readdir.
@@ -120,12 +423,47 @@ func (f *File) Readdirnames(n int) ([]string, error) {
 	return f.glfs.Readdirnames(n)
 }
 
+// SEEK_DATA and SEEK_HOLE are the whence values of Seek which move to the
+// next region of data or the next hole at or after offset.
+const (
+	SEEK_DATA = 3
+	SEEK_HOLE = 4
+)
+
 // Seek sets the offset for the next read or write on the file based on whence,
-// 0 - relative to beginning of file, 1 - relative to current offset, 2 - relative to end
+// 0 - relative to beginning of file, 1 - relative to current offset, 2 - relative to end,
+// or SEEK_DATA or SEEK_HOLE
 //
-// Returns new offset and an error if any
+// Returns new offset and an error if any. The error is an *os.PathError
+// wrapping syscall.EINVAL for any other whence, or if the resulting offset
+// would be negative.
 func (f *File) Seek(offset int64, whence int) (int64, error) {
-	return f.glfs.lseek(offset, whence)
+	switch whence {
+	case io.SeekStart:
+		if offset < 0 {
+			return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+		}
+	case io.SeekCurrent, io.SeekEnd, SEEK_DATA, SEEK_HOLE:
+	default:
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+
+	ret, err := f.glfs.lseek(offset, whence)
+	if ret < 0 {
+		if err == nil {
+			err = syscall.EINVAL
+		}
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: err}
+	}
+	return ret, nil
+}
+
+// Offset returns the current offset of the file, where the next Read or
+// Write starts, without moving it.
+//
+// Returns an error on failure
+func (f *File) Offset() (int64, error) {
+	return f.Seek(0, io.SeekCurrent)
 }
 
 // Stat returns an os.FileInfo object describing the file
@@ -141,6 +479,39 @@ func (f *File) Stat() (os.FileInfo, error) {
 	return fileInfoFromStat(&stat, f.name), nil
 }
 
+// StatCached is like Stat, but returns the result of the previous call to
+// StatCached until the file is changed through f, by writing, truncating or
+// changing its attributes. Changes made through other Files or clients are
+// not seen, so Stat is needed where the information must be fresh.
+//
+// Returns an error on failure
+func (f *File) StatCached() (os.FileInfo, error) {
+	f.statMu.Lock()
+	defer f.statMu.Unlock()
+
+	if f.statInfo != nil {
+		return f.statInfo, nil
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	f.statInfo = info
+	return info, nil
+}
+
+// Size returns the size of the file in bytes. It is cheaper than Stat when
+// only the size is needed, as no os.FileInfo is built.
+//
+// Returns an error on failure
+func (f *File) Size() (int64, error) {
+	var stat syscall.Stat_t
+	if err := f.glfs.Fstat(&stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Size), nil
+}
+
 // Sync commits the file to the storage
 //
 // Returns error on failure
@@ -148,11 +519,60 @@ func (f *File) Sync() error {
 	return f.glfs.Fsync()
 }
 
-// Truncate changes the size of the file
+// Flush pushes the data written to the file out of the client's write-behind
+// buffers to the bricks, so that it is visible to other fds and clients.
+// gfapi has no separate flush call, so this is a data-only sync: it is lighter
+// than Sync, which also commits the file's metadata.
 //
 // Returns error on failure
+func (f *File) Flush() error {
+	if err := f.glfs.Fdatasync(); err != nil {
+		return &os.PathError{Op: "flush", Path: f.name, Err: err}
+	}
+	return nil
+}
+
+// Flags for SyncRange, with the same values as for sync_file_range(2).
+const (
+	SYNC_FILE_RANGE_WAIT_BEFORE = 1
+	SYNC_FILE_RANGE_WRITE       = 2
+	SYNC_FILE_RANGE_WAIT_AFTER  = 4
+)
+
+// SyncRange commits the nbytes bytes of the file starting at offset to the
+// storage, or everything from offset on if nbytes is 0, like
+// sync_file_range(2) with flags. With flags 0 it does nothing.
+// gfapi has no call syncing part of a file, so any other flags sync the
+// whole file with Sync: the range is made durable, but so is the rest.
+//
+// Returns an error on failure
+func (f *File) SyncRange(offset, nbytes int64, flags int) error {
+	if offset < 0 || nbytes < 0 ||
+		flags&^(SYNC_FILE_RANGE_WAIT_BEFORE|SYNC_FILE_RANGE_WRITE|SYNC_FILE_RANGE_WAIT_AFTER) != 0 {
+		return &os.PathError{Op: "syncrange", Path: f.name, Err: syscall.EINVAL}
+	}
+	if flags == 0 {
+		return nil
+	}
+	if err := f.glfs.Fsync(); err != nil {
+		return &os.PathError{Op: "syncrange", Path: f.name, Err: err}
+	}
+	return nil
+}
+
+// Truncate changes the size of the file. Growing the file does not allocate
+// the new space; the extension is a hole which reads back as zeros.
+//
+// Returns error on failure, ErrNegativeSize if size is negative
 func (f *File) Truncate(size int64) error {
-	return f.glfs.Ftruncate(size)
+	if err := f.checkIO("truncate"); err != nil {
+		return err
+	}
+	defer f.invalidateStat()
+	if err := f.glfs.Ftruncate(size); err != nil {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: err}
+	}
+	return nil
 }
 
 // Write writes len(b) bytes to the file
@@ -162,7 +582,11 @@ func (f *File) Write(b []byte) (n int, err error) {
 	if f == nil {
 		return 0, os.ErrInvalid
 	}
+	if err := f.checkIO("write"); err != nil {
+		return 0, err
+	}
 	n, e := f.glfs.Write(b)
+	f.invalidateStat()
 
 	if n != len(b) {
 		err = io.ErrShortWrite
@@ -177,9 +601,38 @@ func (f *File) Write(b []byte) (n int, err error) {
 //
 // Returns number of bytes written and an error if any
 func (f *File) WriteAt(b []byte, off int64) (int, error) {
+	if err := f.checkIO("write"); err != nil {
+		return 0, err
+	}
+	defer f.invalidateStat()
 	return f.glfs.Pwrite(b, off)
 }
 
+// Preadv reads into the buffers in bufs in turn, starting from offset off,
+// with a single call. Like ReadAt, it does not change the offset of the file,
+// but unlike it, it may read less than the buffers hold without an error.
+//
+// Returns number of bytes read and an error if any
+func (f *File) Preadv(bufs [][]byte, off int64) (int, error) {
+	if err := f.checkIO("read"); err != nil {
+		return 0, err
+	}
+	return f.glfs.Preadv(bufs, off)
+}
+
+// Pwritev writes the buffers in bufs in turn, starting from offset off, with
+// a single call, so that records assembled from several buffers need not be
+// copied together first. Like WriteAt, it does not change the offset of the file.
+//
+// Returns number of bytes written and an error if any
+func (f *File) Pwritev(bufs [][]byte, off int64) (int, error) {
+	if err := f.checkIO("write"); err != nil {
+		return 0, err
+	}
+	defer f.invalidateStat()
+	return f.glfs.Pwritev(bufs, off)
+}
+
 // WriteString writes the contents of string s to the file
 //
 // Returns number of bytes written and an error if any
@@ -187,13 +640,40 @@ func (f *File) WriteString(s string) (int, error) {
 	return f.Write([]byte(s))
 }
 
+// WriteStringAt writes the contents of string s to the file starting at
+// offset off, like WriteAt
+//
+// Returns number of bytes written and an error if any
+func (f *File) WriteStringAt(s string, off int64) (int, error) {
+	return f.WriteAt([]byte(s), off)
+}
+
 // Manipulate the allocated disk space for the file
 //
 // Returns error on failure
 func (f *File) Fallocate(mode int, offset int64, len int64) error {
+	defer f.invalidateStat()
 	return f.glfs.Fallocate(mode, offset, len)
 }
 
+// Zerofill sets the length bytes of the file starting at offset to zeros,
+// which unlike a hole are allocated on the bricks.
+//
+// Returns an error on failure
+func (f *File) Zerofill(offset, length int64) error {
+	defer f.invalidateStat()
+	if offset < 0 {
+		return &os.PathError{Op: "zerofill", Path: f.name, Err: ErrNegativeOffset}
+	}
+	if length < 0 {
+		return &os.PathError{Op: "zerofill", Path: f.name, Err: ErrNegativeSize}
+	}
+	if err := f.glfs.Zerofill(offset, length); err != nil {
+		return &os.PathError{Op: "zerofill", Path: f.name, Err: err}
+	}
+	return nil
+}
+
 // Get value of the extended attribute 'attr' and place it in 'dest'
 //
 // Returns number of bytes placed in 'dest' and error if any
@@ -201,10 +681,29 @@ func (f *File) Getxattr(attr string, dest []byte) (int64, error) {
 	return f.glfs.Fgetxattr(attr, dest)
 }
 
+// GetxattrValue returns the value of the extended attribute 'attr' in a
+// slice of exactly its size
+//
+// Returns an error wrapping ErrNoXattr if the file has no such attribute,
+// one wrapping ErrXattrPermission if reading it is denied, and an error on failure
+func (f *File) GetxattrValue(attr string) ([]byte, error) {
+	value, err := xattrBuffer(func(dest []byte) (int64, error) {
+		return f.glfs.Fgetxattr(attr, dest)
+	})
+	if err == syscall.ENODATA {
+		err = ErrNoXattr
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "getxattr", Path: f.name, Err: xattrError(attr, err)}
+	}
+	return value, nil
+}
+
 // Set extended attribute with key 'attr' and value 'data'
 //
 // Returns error on failure
 func (f *File) Setxattr(attr string, data []byte, flags int) error {
+	defer f.invalidateStat()
 	return f.glfs.Fsetxattr(attr, data, flags)
 }
 
@@ -212,5 +711,18 @@ func (f *File) Setxattr(attr string, data []byte, flags int) error {
 //
 // Returns error on failure
 func (f *File) Removexattr(attr string) error {
+	defer f.invalidateStat()
 	return f.glfs.Fremovexattr(attr)
 }
+
+// invalidateStat drops the result of StatCached and the Volume's cached
+// Stat result for the file after it has been changed through f.
+func (f *File) invalidateStat() {
+	f.statMu.Lock()
+	f.statInfo = nil
+	f.statMu.Unlock()
+
+	if f.vol != nil {
+		f.vol.InvalidateStatCache(f.name)
+	}
+}
@@ -1,12 +1,30 @@
 package gfapi
 
 import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"math"
 	"os"
+	"os/user"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 /* The testcases assume that it is being run on a peer in a gluster cluster,
@@ -97,6 +115,31 @@ func TestMkdirAll(t *testing.T) {
 	}
 }
 
+func TestMkdirAllConcurrent(t *testing.T) {
+	// A fresh base, so that the goroutines race to create every level.
+	base := tmpDir + "/TestMkdirAllConcurrent/" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 16)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = vol.MkdirAll(base+"/a/b/"+strconv.Itoa(i%4)+"/c", 0755)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		check(t, err == nil, "concurrent MkdirAll %d: %s", i, err)
+	}
+	for i := 0; i < 4; i++ {
+		dir := base + "/a/b/" + strconv.Itoa(i) + "/c"
+		fi, err := vol.Stat(dir)
+		check(t, err == nil && fi.IsDir(), "Stat %q: %v", dir, err)
+	}
+}
+
 func TestCreate(t *testing.T) {
 	f, err := vol.Create(tmpDir + "/test")
 
@@ -336,6 +379,122 @@ func TestReaddirnames(t *testing.T) {
 
 //cursor
 
+func TestVolumeReadDirNames(t *testing.T) {
+	tmpReadDir, clean := setupReaddir(t)
+	defer clean()
+
+	names, err := vol.ReadDirNames(tmpReadDir)
+	check(t, err == nil, "ReadDirNames %q: %s", tmpReadDir, err)
+	expected := []string{"dir", "file"}
+	check(t, reflect.DeepEqual(names, expected),
+		"ReadDirNames %q: %v != %v", tmpReadDir, names, expected)
+
+	names, err = vol.ReadDirNamesWithDots(tmpReadDir)
+	check(t, err == nil, "ReadDirNamesWithDots %q: %s", tmpReadDir, err)
+	expected = []string{".", "..", "dir", "file"}
+	check(t, reflect.DeepEqual(names, expected),
+		"ReadDirNamesWithDots %q: %v != %v", tmpReadDir, names, expected)
+}
+
+func TestReadDirFiltered(t *testing.T) {
+	tmpReadDir, clean := setupReaddir(t)
+	defer clean()
+
+	infos, err := vol.ReadDirFiltered(tmpReadDir, os.FileInfo.IsDir)
+	check(t, err == nil, "ReadDirFiltered %q: %s", tmpReadDir, err)
+	check(t, len(infos) == 1 && infos[0].Name() == "dir" && infos[0].IsDir(),
+		"ReadDirFiltered %q kept %v instead of only dir", tmpReadDir, infos)
+
+	infos, err = vol.ReadDirFiltered(tmpReadDir, func(info os.FileInfo) bool { return info.Mode().IsRegular() })
+	check(t, err == nil, "ReadDirFiltered %q: %s", tmpReadDir, err)
+	check(t, len(infos) == 1 && infos[0].Name() == "file" && infos[0].Size() == int64(len(data)),
+		"ReadDirFiltered %q kept %v instead of only file", tmpReadDir, infos)
+}
+
+func TestDirEntryCount(t *testing.T) {
+	tmpReadDir, clean := setupReaddir(t)
+	defer clean()
+
+	n, err := vol.DirEntryCount(tmpReadDir)
+	check(t, err == nil, "DirEntryCount %q: %s", tmpReadDir, err)
+	check(t, n == 2, "DirEntryCount %q: %d != 2", tmpReadDir, n)
+
+	_, err = vol.DirEntryCount(tmpReadDir + "/file")
+	check(t, errors.Is(err, syscall.ENOTDIR), "DirEntryCount of a file returned %v instead of ENOTDIR", err)
+}
+
+func TestListDir(t *testing.T) {
+	dir := tmpDir + "/TestListDir"
+	err := vol.MkdirAll(dir, 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+
+	var want []string
+	for i := 0; i < 10; i++ {
+		name := "file" + strconv.Itoa(i)
+		f, err := vol.Create(dir + "/" + name)
+		check(t, err == nil, "Create %q: %s", dir+"/"+name, err)
+		f.Close()
+		defer vol.Unlink(dir + "/" + name)
+		want = append(want, name)
+	}
+
+	var got []string
+	token, pages := "", 0
+	for {
+		entries, next, err := vol.ListDir(dir, token, 3)
+		check(t, err == nil, "ListDir %q, page %d: %s", dir, pages, err)
+		check(t, len(entries) <= 3, "ListDir %q, page %d: %d entries", dir, pages, len(entries))
+		for _, fi := range entries {
+			got = append(got, fi.Name())
+		}
+		pages++
+		if next == "" {
+			break
+		}
+		check(t, pages < 10, "ListDir %q doesn't end", dir)
+		token = next
+	}
+
+	sort.Strings(got)
+	check(t, reflect.DeepEqual(got, want), "ListDir %q: %v != %v", dir, got, want)
+	check(t, pages == 4, "ListDir %q took %d pages of 3 instead of 4", dir, pages)
+
+	_, _, err = vol.ListDir(dir, "not a token", 3)
+	check(t, errors.Is(err, syscall.EINVAL), "ListDir with a malformed token returned %v", err)
+}
+
+func TestDirType(t *testing.T) {
+	var d interface{} = (*Dir)(nil)
+	_, ok := d.(io.Reader)
+	check(t, !ok, "*Dir implements io.Reader")
+	_, ok = d.(io.Writer)
+	check(t, !ok, "*Dir implements io.Writer")
+	_, ok = d.(io.Seeker)
+	check(t, !ok, "*Dir implements io.Seeker")
+	_, ok = d.(fs.ReadDirFile)
+	check(t, !ok, "*Dir implements fs.ReadDirFile, which includes Read")
+	_, ok = d.(io.Closer)
+	check(t, ok, "*Dir doesn't implement io.Closer")
+}
+
+func TestOpenDirTyped(t *testing.T) {
+	tmpReadDir, clean := setupReaddir(t)
+	defer clean()
+
+	d, err := vol.OpenDirTyped(tmpReadDir)
+	check(t, err == nil, "OpenDirTyped %q: %s", tmpReadDir, err)
+	defer d.Close()
+
+	names, err := d.Readdirnames(0)
+	check(t, err == nil, "Readdirnames %q: %s", tmpReadDir, err)
+	sort.Strings(names)
+	expected := []string{".", "..", "dir", "file"}
+	check(t, reflect.DeepEqual(names, expected), "Readdirnames %q: %v != %v", tmpReadDir, names, expected)
+
+	_, err = vol.OpenDirTyped(tmpReadDir + "/file")
+	check(t, errors.Is(err, syscall.ENOTDIR), "OpenDirTyped of a file returned %v instead of ENOTDIR", err)
+}
+
 func TestReaddir(t *testing.T) {
 	tmpReadDir, clean := setupReaddir(t)
 	defer clean()
@@ -460,6 +619,2830 @@ func TestReaddirR(t *testing.T) {
 	check(t, err == nil, "Close %q: %s", tmpReadDir, err)
 }
 
+func TestPositionalIOBounds(t *testing.T) {
+	f, err := vol.Create(tmpDir + "/TestPositionalIOBounds")
+	check(t, err == nil, "Create: %v", err)
+	defer f.Close()
+
+	buf := make([]byte, 4)
+	n, err := f.ReadAt(buf, -1)
+	check(t, n == 0 && err == ErrNegativeOffset, "ReadAt negative offset: %d, %v", n, err)
+	n, err = f.WriteAt(buf, -1)
+	check(t, n == 0 && err == ErrNegativeOffset, "WriteAt negative offset: %d, %v", n, err)
+
+	n, err = f.ReadAt(nil, 0)
+	check(t, n == 0 && err == nil, "ReadAt empty buffer: %d, %v", n, err)
+	n, err = f.WriteAt([]byte{}, 0)
+	check(t, n == 0 && err == nil, "WriteAt empty buffer: %d, %v", n, err)
+}
+
+func TestGlusterVersion(t *testing.T) {
+	version := GlusterVersion()
+	check(t, version != "", "GlusterVersion returned an empty string")
+
+	for _, part := range strings.Split(version, ".") {
+		_, err := strconv.Atoi(part)
+		check(t, err == nil, "GlusterVersion %q is not parseable: %v", version, err)
+	}
+
+	// The headers may not define GFAPI_VERSION, but if they do it must parse.
+	if compiled := CompiledGlusterVersion(); compiled != "" {
+		for _, part := range strings.Split(compiled, ".") {
+			_, err := strconv.Atoi(part)
+			check(t, err == nil, "CompiledGlusterVersion %q is not parseable: %v", compiled, err)
+		}
+	}
+}
+
+func TestSupports(t *testing.T) {
+	check(t, !Supports("no_such_feature"), "unknown feature reported as supported")
+
+	// Without a volume, UnsetVolfileServer fails either way, but only with
+	// ErrUnsupported if the feature is missing.
+	v := new(Volume)
+	err := v.UnsetVolfileServer("tcp", "localhost", 24007)
+	check(t, err != nil, "UnsetVolfileServer on an uninitialized volume succeeded")
+	check(t, errors.Is(err, ErrUnsupported) == !Supports(FeatureUnsetVolfileServer),
+		"UnsetVolfileServer returned %v with Supports %v", err, Supports(FeatureUnsetVolfileServer))
+
+	// Pretend the loaded library lacks the call.
+	symbol := featureSymbols[FeatureUnsetVolfileServer]
+	optionalFuncs.Store(symbol, lookupSymbol("no_such_symbol"))
+	defer optionalFuncs.Delete(symbol)
+
+	check(t, !Supports(FeatureUnsetVolfileServer), "missing %s reported as supported", symbol)
+	err = v.UnsetVolfileServer("tcp", "localhost", 24007)
+	check(t, errors.Is(err, ErrUnsupported), "UnsetVolfileServer without %s: %v", symbol, err)
+}
+
+func TestChownUnchangedUid(t *testing.T) {
+	path := tmpDir + "/TestChownUnchangedUid"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	f.Close()
+
+	before, err := vol.Stat(path)
+	check(t, err == nil, "Stat %q: %s", path, err)
+	uid := before.Sys().(*syscall.Stat_t).Uid
+
+	gid := os.Getgid()
+	err = vol.Chown(path, -1, gid)
+	check(t, err == nil, "Chown %q: %s", path, err)
+
+	after, err := vol.Stat(path)
+	check(t, err == nil, "Stat %q: %s", path, err)
+	st := after.Sys().(*syscall.Stat_t)
+	check(t, st.Uid == uid, "owner changed %d != %d", st.Uid, uid)
+	check(t, int(st.Gid) == gid, "group not changed %d != %d", st.Gid, gid)
+}
+
+func TestChownName(t *testing.T) {
+	path := tmpDir + "/TestChownName"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	f.Close()
+
+	u, err := user.Current()
+	check(t, err == nil, "user.Current: %s", err)
+
+	before, err := vol.Stat(path)
+	check(t, err == nil, "Stat %q: %s", path, err)
+	gid := before.Sys().(*syscall.Stat_t).Gid
+
+	err = vol.ChownName(path, u.Username, "")
+	check(t, err == nil, "ChownName %q: %s", path, err)
+
+	after, err := vol.Stat(path)
+	check(t, err == nil, "Stat %q: %s", path, err)
+	st := after.Sys().(*syscall.Stat_t)
+	check(t, strconv.Itoa(int(st.Uid)) == u.Uid, "owner not changed %d != %s", st.Uid, u.Uid)
+	check(t, st.Gid == gid, "group changed %d != %d", st.Gid, gid)
+
+	err = vol.ChownName(path, "no-such-user-gogfapi", "")
+	check(t, err != nil, "ChownName %q with an unknown user succeeded", path)
+}
+
+func TestFileStatCached(t *testing.T) {
+	path := tmpDir + "/TestFileStatCached"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer f.Close()
+
+	fi, err := f.StatCached()
+	check(t, err == nil, "StatCached %q: %s", path, err)
+	check(t, fi.Size() == 0, "StatCached %q: size %d != 0", path, fi.Size())
+
+	again, err := f.StatCached()
+	check(t, err == nil, "StatCached %q: %s", path, err)
+	check(t, again == fi, "second StatCached %q didn't return the cached result", path)
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+	fi, err = f.StatCached()
+	check(t, err == nil, "StatCached %q: %s", path, err)
+	check(t, fi.Size() == int64(len(data)), "StatCached %q after Write: size %d != %d", path, fi.Size(), len(data))
+
+	err = f.Truncate(1)
+	check(t, err == nil, "Truncate %q: %s", path, err)
+	fi, err = f.StatCached()
+	check(t, err == nil, "StatCached %q: %s", path, err)
+	check(t, fi.Size() == 1, "StatCached %q after Truncate: size %d != 1", path, fi.Size())
+}
+
+func TestFileChownUnchangedUid(t *testing.T) {
+	path := tmpDir + "/TestFileChownUnchangedUid"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer f.Close()
+
+	before, err := f.Stat()
+	check(t, err == nil, "Stat %q: %s", path, err)
+	uid := before.Sys().(*syscall.Stat_t).Uid
+
+	gid := os.Getgid()
+	err = f.Chown(-1, gid)
+	check(t, err == nil, "Chown %q: %s", path, err)
+
+	after, err := f.Stat()
+	check(t, err == nil, "Stat %q: %s", path, err)
+	st := after.Sys().(*syscall.Stat_t)
+	check(t, st.Uid == uid, "owner changed %d != %d", st.Uid, uid)
+	check(t, int(st.Gid) == gid, "group not changed %d != %d", st.Gid, gid)
+}
+
+func TestOpenFileContext(t *testing.T) {
+	path := tmpDir + "/TestOpenFileContext"
+
+	f, err := vol.OpenFileContext(context.Background(), path, os.O_RDWR|os.O_CREATE, 0644)
+	check(t, err == nil, "OpenFileContext %q: %s", path, err)
+	f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	f, err = vol.OpenFileContext(ctx, path, os.O_RDONLY, 0)
+	check(t, f == nil, "OpenFileContext returned a file for a canceled context")
+	check(t, errors.Is(err, context.Canceled), "OpenFileContext %q: %v != %v", path, err, context.Canceled)
+}
+
+func TestMkdirAllMany(t *testing.T) {
+	base := tmpDir + "/_TestMkdirAllMany_"
+	err := vol.MkdirAll(base, 0777)
+	check(t, err == nil, "MkdirAll %q: %s", base, err)
+
+	fpath := base + "/file"
+	f, err := vol.Create(fpath)
+	check(t, err == nil, "Create %q: %s", fpath, err)
+	f.Close()
+
+	paths := []string{
+		base + "/a/b",
+		fpath + "/sub",
+		base + "/c",
+		fpath,
+	}
+	errs := vol.MkdirAllMany(paths, 0755)
+	check(t, len(errs) == len(paths), "got %d errors for %d paths", len(errs), len(paths))
+
+	for i, failed := range []bool{false, true, false, true} {
+		check(t, (errs[i] != nil) == failed, "MkdirAllMany %q: unexpected error %v", paths[i], errs[i])
+	}
+
+	for _, path := range []string{paths[0], paths[2]} {
+		fi, err := vol.Stat(path)
+		check(t, err == nil && fi.IsDir(), "%q was not created: %v", path, err)
+	}
+}
+
+func TestFileTruncate(t *testing.T) {
+	path := tmpDir + "/TestFileTruncate"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer f.Close()
+
+	_, err = f.Write([]byte("0123456789"))
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	err = f.Truncate(-1)
+	check(t, errors.Is(err, ErrNegativeSize), "Truncate(-1) %q: %v", path, err)
+
+	err = f.Truncate(4)
+	check(t, err == nil, "Truncate(4) %q: %s", path, err)
+	fi, err := f.Stat()
+	check(t, err == nil, "Stat %q: %s", path, err)
+	check(t, fi.Size() == 4, "incorrect size after shrink %d != 4", fi.Size())
+
+	err = f.Truncate(8)
+	check(t, err == nil, "Truncate(8) %q: %s", path, err)
+	buf := make([]byte, 8)
+	n, err := f.ReadAt(buf, 0)
+	check(t, n == 8, "ReadAt %q: %d, %v", path, n, err)
+	check(t, string(buf) == "0123\x00\x00\x00\x00", "incorrect content after grow %q", buf)
+}
+
+type countingStatter struct {
+	calls int
+}
+
+func (s *countingStatter) stat(name string) (os.FileInfo, error) {
+	s.calls++
+	return &fileInfo{name: filepath.Base(name)}, nil
+}
+
+func TestStatCache(t *testing.T) {
+	src := &countingStatter{}
+	v := &Volume{mounted: true, statCache: newStatCache(src, time.Minute)}
+
+	for i := 0; i < 2; i++ {
+		fi, err := v.Stat("/dir/file")
+		check(t, err == nil, "Stat: %v", err)
+		check(t, fi.Name() == "file", "incorrect name %q", fi.Name())
+	}
+	check(t, src.calls == 1, "second Stat within the TTL hit the source, %d calls", src.calls)
+
+	v.InvalidateStatCache("/dir")
+	_, err := v.Stat("/dir/file")
+	check(t, err == nil, "Stat: %v", err)
+	check(t, src.calls == 2, "Stat after invalidation didn't hit the source, %d calls", src.calls)
+
+	v.statCache.ttl = 0
+	_, err = v.Stat("/dir/other")
+	check(t, err == nil, "Stat: %v", err)
+	_, err = v.Stat("/dir/other")
+	check(t, err == nil, "Stat: %v", err)
+	check(t, src.calls == 4, "expired entry was served from the cache, %d calls", src.calls)
+
+	// Cached entries are not served once unmounted
+	v.statCache.ttl = time.Minute
+	_, err = v.Stat("/dir/file")
+	check(t, err == nil, "Stat: %v", err)
+	v.mounted = false
+	_, err = v.Stat("/dir/file")
+	check(t, errors.Is(err, ErrNotMounted), "Stat after unmount: %v", err)
+}
+
+type countingStatvfser struct {
+	calls int
+}
+
+func (s *countingStatvfser) statvfs(name string, buf *Statvfs_t) error {
+	s.calls++
+	buf.Bsize = uint64(s.calls)
+	return nil
+}
+
+func TestStatvfsCache(t *testing.T) {
+	src := &countingStatvfser{}
+	v := &Volume{mounted: true, statvfsCache: newStatvfsCache(src, time.Minute)}
+
+	for i := 0; i < 2; i++ {
+		var buf Statvfs_t
+		err := v.Statvfs("/", &buf)
+		check(t, err == nil, "Statvfs: %v", err)
+		check(t, buf.Bsize == 1, "Statvfs returned Bsize %d instead of the cached 1", buf.Bsize)
+	}
+	check(t, src.calls == 1, "second Statvfs within the TTL hit the source, %d calls", src.calls)
+
+	v.InvalidateStatvfsCache()
+	var buf Statvfs_t
+	err := v.Statvfs("/", &buf)
+	check(t, err == nil, "Statvfs: %v", err)
+	check(t, src.calls == 2, "Statvfs after invalidation didn't hit the source, %d calls", src.calls)
+
+	v.statvfsCache.ttl = 0
+	err = v.Statvfs("/dir", &buf)
+	check(t, err == nil, "Statvfs: %v", err)
+	err = v.Statvfs("/dir", &buf)
+	check(t, err == nil, "Statvfs: %v", err)
+	check(t, src.calls == 4, "expired entry was served from the cache, %d calls", src.calls)
+
+	// Cached entries are not served once unmounted
+	v.statvfsCache.ttl = time.Minute
+	err = v.Statvfs("/", &buf)
+	check(t, err == nil, "Statvfs: %v", err)
+	v.mounted = false
+	err = v.Statvfs("/", &buf)
+	check(t, errors.Is(err, ErrNotMounted), "Statvfs after unmount: %v", err)
+}
+
+func TestFileSize(t *testing.T) {
+	path := tmpDir + "/TestFileSize"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer f.Close()
+
+	size, err := f.Size()
+	check(t, err == nil, "Size %q: %s", path, err)
+	check(t, size == 0, "incorrect size of new file %d != 0", size)
+
+	buf := make([]byte, 1234)
+	n, err := f.Write(buf)
+	check(t, err == nil, "Write %q: %s", path, err)
+
+	size, err = f.Size()
+	check(t, err == nil, "Size %q: %s", path, err)
+	check(t, size == int64(n), "incorrect size %d != %d", size, n)
+}
+
+func TestNewReaderAt(t *testing.T) {
+	path := tmpDir + "/TestNewReaderAt"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer f.Close()
+
+	_, err = f.WriteString("0123456789")
+	check(t, err == nil, "WriteString %q: %s", path, err)
+	_, err = f.Seek(0, io.SeekStart)
+	check(t, err == nil, "Seek %q: %s", path, err)
+
+	ra, err := f.NewReaderAt()
+	check(t, err == nil, "NewReaderAt %q: %s", path, err)
+	defer ra.(io.Closer).Close()
+
+	buf := make([]byte, 3)
+	_, err = io.ReadFull(f, buf)
+	check(t, err == nil && string(buf) == "012", "Read %q: %q, %v", path, buf, err)
+
+	_, err = ra.ReadAt(buf, 7)
+	check(t, err == nil && string(buf) == "789", "ReadAt %q: %q, %v", path, buf, err)
+
+	_, err = io.ReadFull(f, buf)
+	check(t, err == nil && string(buf) == "345", "Read after ReadAt %q: %q, %v", path, buf, err)
+
+	_, err = ra.ReadAt(buf, 1)
+	check(t, err == nil && string(buf) == "123", "ReadAt after Read %q: %q, %v", path, buf, err)
+
+	off, err := f.Seek(0, io.SeekCurrent)
+	check(t, err == nil && off == 6, "offset disturbed by ReadAt %d != 6, %v", off, err)
+}
+
+func TestReadlinksIn(t *testing.T) {
+	dir := tmpDir + "/TestReadlinksIn"
+	err := vol.MkdirAll(dir, 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+
+	want := map[string]string{"a": "file", "b": "/elsewhere"}
+	for name, target := range want {
+		vol.Unlink(dir + "/" + name)
+		err = vol.Symlink(target, dir+"/"+name)
+		check(t, err == nil, "Symlink %q: %s", dir+"/"+name, err)
+		defer vol.Unlink(dir + "/" + name)
+	}
+	vol.Unlink(dir + "/file")
+	f, err := vol.Create(dir + "/file")
+	check(t, err == nil, "Create %q: %s", dir+"/file", err)
+	f.Close()
+	defer vol.Unlink(dir + "/file")
+
+	got, err := vol.ReadlinksIn(dir)
+	check(t, err == nil, "ReadlinksIn %q: %s", dir, err)
+	check(t, reflect.DeepEqual(got, want), "ReadlinksIn %q: %v != %v", dir, got, want)
+}
+
+func TestReadlinkat(t *testing.T) {
+	if !Supports(FeatureOpenat) {
+		t.Skip("libgfapi lacks the *at calls")
+	}
+
+	dir := tmpDir + "/TestReadlinkat"
+	err := vol.MkdirAll(dir, 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+
+	err = vol.Symlink("target", dir+"/link")
+	check(t, err == nil, "Symlink %q: %s", dir+"/link", err)
+	defer vol.Unlink(dir + "/link")
+
+	target, err := vol.Readlink(dir + "/link")
+	check(t, err == nil && target == "target", "Readlink %q: %q, %v", dir+"/link", target, err)
+
+	d, err := vol.OpenDir(dir)
+	check(t, err == nil, "OpenDir %q: %s", dir, err)
+	defer d.Close()
+
+	target, err = d.Readlinkat("link")
+	check(t, err == nil, "Readlinkat %q: %s", "link", err)
+	check(t, target == "target", "incorrect link destination %q != %q", target, "target")
+}
+
+func TestLinkatSymlinkat(t *testing.T) {
+	if !Supports(FeatureOpenat) {
+		t.Skip("libgfapi lacks the *at calls")
+	}
+
+	base := tmpDir + "/TestLinkatSymlinkat"
+	for _, dir := range []string{base + "/a", base + "/b"} {
+		err := vol.MkdirAll(dir, 0755)
+		check(t, err == nil, "MkdirAll %q: %s", dir, err)
+	}
+
+	f, err := vol.Create(base + "/a/file")
+	check(t, err == nil, "Create %q: %s", base+"/a/file", err)
+	f.Close()
+	defer vol.Unlink(base + "/a/file")
+
+	a, err := vol.OpenDir(base + "/a")
+	check(t, err == nil, "OpenDir %q: %s", base+"/a", err)
+	defer a.Close()
+	b, err := vol.OpenDir(base + "/b")
+	check(t, err == nil, "OpenDir %q: %s", base+"/b", err)
+	defer b.Close()
+
+	err = a.Linkat("file", b, "hardlink", 0)
+	check(t, err == nil, "Linkat: %s", err)
+	defer vol.Unlink(base + "/b/hardlink")
+
+	orig, err := vol.Stat(base + "/a/file")
+	check(t, err == nil, "Stat %q: %s", base+"/a/file", err)
+	link, err := vol.Stat(base + "/b/hardlink")
+	check(t, err == nil, "Stat %q: %s", base+"/b/hardlink", err)
+	check(t, orig.Sys().(*syscall.Stat_t).Ino == link.Sys().(*syscall.Stat_t).Ino,
+		"hard link refers to a different inode")
+
+	err = b.Symlinkat("../a/file", "symlink")
+	check(t, err == nil, "Symlinkat: %s", err)
+	defer vol.Unlink(base + "/b/symlink")
+
+	target, err := vol.Readlink(base + "/b/symlink")
+	check(t, err == nil && target == "../a/file", "Readlink %q: %q, %v", base+"/b/symlink", target, err)
+}
+
+func TestUnlinkatMkdirat(t *testing.T) {
+	if !Supports(FeatureOpenat) {
+		t.Skip("libgfapi lacks the *at calls")
+	}
+
+	dir := tmpDir + "/TestUnlinkatMkdirat"
+	err := vol.MkdirAll(dir, 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+
+	d, err := vol.OpenDir(dir)
+	check(t, err == nil, "OpenDir %q: %s", dir, err)
+	defer d.Close()
+
+	err = d.Mkdirat("sub", 0750)
+	check(t, err == nil, "Mkdirat %q: %s", "sub", err)
+	fi, err := vol.Stat(dir + "/sub")
+	check(t, err == nil && fi.IsDir(), "Stat %q: %v", dir+"/sub", err)
+
+	f, err := vol.Create(dir + "/file")
+	check(t, err == nil, "Create %q: %s", dir+"/file", err)
+	f.Close()
+
+	err = d.Unlinkat("file", 0)
+	check(t, err == nil, "Unlinkat %q: %s", "file", err)
+	_, err = vol.Stat(dir + "/file")
+	check(t, err != nil, "%q still exists after Unlinkat", dir+"/file")
+
+	err = d.Unlinkat("sub", 0)
+	check(t, err != nil, "Unlinkat %q without AT_REMOVEDIR removed a directory", "sub")
+
+	err = d.Unlinkat("sub", AT_REMOVEDIR)
+	check(t, err == nil, "Unlinkat %q: %s", "sub", err)
+	_, err = vol.Stat(dir + "/sub")
+	check(t, err != nil, "%q still exists after Unlinkat", dir+"/sub")
+}
+
+func TestRenameat(t *testing.T) {
+	if !Supports(FeatureOpenat) {
+		t.Skip("libgfapi lacks the *at calls")
+	}
+
+	base := tmpDir + "/TestRenameat"
+	for _, dir := range []string{base + "/a", base + "/b"} {
+		err := vol.MkdirAll(dir, 0755)
+		check(t, err == nil, "MkdirAll %q: %s", dir, err)
+	}
+
+	f, err := vol.Create(base + "/a/file")
+	check(t, err == nil, "Create %q: %s", base+"/a/file", err)
+	_, err = f.WriteString("renameat")
+	check(t, err == nil, "WriteString %q: %s", base+"/a/file", err)
+	f.Close()
+
+	a, err := vol.OpenDir(base + "/a")
+	check(t, err == nil, "OpenDir %q: %s", base+"/a", err)
+	defer a.Close()
+	b, err := vol.OpenDir(base + "/b")
+	check(t, err == nil, "OpenDir %q: %s", base+"/b", err)
+	defer b.Close()
+
+	err = a.Renameat("file", b, "moved")
+	check(t, err == nil, "Renameat: %s", err)
+	defer vol.Unlink(base + "/b/moved")
+
+	_, err = vol.Stat(base + "/a/file")
+	check(t, err != nil, "%q still exists after Renameat", base+"/a/file")
+	fi, err := vol.Stat(base + "/b/moved")
+	check(t, err == nil, "Stat %q: %s", base+"/b/moved", err)
+	check(t, fi.Size() == int64(len("renameat")), "incorrect size of moved file %d", fi.Size())
+}
+
+func TestOpenat(t *testing.T) {
+	if !Supports(FeatureOpenat) {
+		t.Skip("libgfapi lacks the *at calls")
+	}
+
+	dir := tmpDir + "/TestOpenat"
+	err := vol.MkdirAll(dir, 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+
+	f, err := vol.Create(dir + "/file")
+	check(t, err == nil, "Create %q: %s", dir+"/file", err)
+	_, err = f.WriteString("openat")
+	check(t, err == nil, "WriteString %q: %s", dir+"/file", err)
+	f.Close()
+	defer vol.Unlink(dir + "/file")
+
+	d, err := vol.OpenDir(dir)
+	check(t, err == nil, "OpenDir %q: %s", dir, err)
+	defer d.Close()
+
+	f, err = d.Openat("file", os.O_RDONLY, 0)
+	check(t, err == nil, "Openat %q: %s", "file", err)
+	defer f.Close()
+	check(t, f.Name() == dir+"/file", "incorrect name %q != %q", f.Name(), dir+"/file")
+
+	buf := make([]byte, 16)
+	n, err := f.Read(buf)
+	check(t, err == nil, "Read %q: %s", f.Name(), err)
+	check(t, string(buf[:n]) == "openat", "incorrect content %q", buf[:n])
+}
+
+func TestDirEntryInfo(t *testing.T) {
+	if !Supports(FeatureOpenat) {
+		t.Skip("libgfapi lacks the *at calls")
+	}
+
+	dir := tmpDir + "/TestDirEntryInfo"
+	err := vol.MkdirAll(dir, 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+
+	f, err := vol.Create(dir + "/file")
+	check(t, err == nil, "Create %q: %s", dir+"/file", err)
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", dir+"/file", err)
+	f.Close()
+
+	d, err := vol.OpenDir(dir)
+	check(t, err == nil, "OpenDir %q: %s", dir, err)
+	defer d.Close()
+
+	entries, err := d.ReadDir(-1)
+	check(t, err == nil, "ReadDir %q: %s", dir, err)
+	check(t, len(entries) == 1 && entries[0].Name() == "file", "incorrect entries %v", entries)
+
+	// With the directory renamed away, only a stat relative to the
+	// directory fd can still find the entry.
+	moved := dir + "-moved"
+	err = vol.Rename(dir, moved)
+	check(t, err == nil, "Rename %q: %s", dir, err)
+	defer func() {
+		vol.Unlink(moved + "/file")
+		vol.Rmdir(moved)
+	}()
+
+	info, err := entries[0].Info()
+	check(t, err == nil, "Info %q: %s", entries[0].Name(), err)
+	check(t, info.Size() == int64(len(data)), "incorrect size %d != %d", info.Size(), len(data))
+}
+
+func TestChmodAllChownAll(t *testing.T) {
+	base := tmpDir + "/TestChmodAll"
+	err := vol.MkdirAll(base+"/a", 0755)
+	check(t, err == nil, "MkdirAll %q: %s", base+"/a", err)
+
+	for _, name := range []string{base + "/a/file", base + "/file"} {
+		f, err := vol.Create(name)
+		check(t, err == nil, "Create %q: %s", name, err)
+		f.Close()
+	}
+	vol.Symlink("file", base+"/link")
+
+	err = vol.ChmodAll(base, 0750)
+	check(t, err == nil, "ChmodAll %q: %s", base, err)
+
+	err = vol.ChownAll(base, -1, os.Getgid())
+	check(t, err == nil, "ChownAll %q: %s", base, err)
+
+	visited := 0
+	err = vol.WalkDir(base, func(name string, d fs.DirEntry, err error) error {
+		check(t, err == nil, "WalkDir %q: %s", name, err)
+		visited++
+
+		info, err := d.Info()
+		check(t, err == nil, "Info %q: %s", name, err)
+		check(t, int(info.Sys().(*syscall.Stat_t).Gid) == os.Getgid(), "%q has incorrect group", name)
+		if d.Type()&os.ModeSymlink == 0 {
+			check(t, info.Mode().Perm() == 0750, "%q has incorrect mode %v", name, info.Mode())
+		}
+		return nil
+	})
+	check(t, err == nil, "WalkDir %q: %s", base, err)
+	check(t, visited == 5, "WalkDir visited %d entries instead of 5", visited)
+}
+
+// setupTree creates a small tree with a directory, files, a symbolic link and
+// a hard link below root, and returns the expected content of each entry.
+func setupTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+
+	err := vol.MkdirAll(root+"/dir", 0755)
+	check(t, err == nil, "MkdirAll %q: %s", root+"/dir", err)
+
+	expected := map[string]string{
+		"dir/":      "",
+		"dir/file":  "nested file",
+		"file":      "top file",
+		"link":      "->file",
+		"dir/hard":  "=>dir/file",
+		"dir/empty": "",
+	}
+
+	for name, content := range expected {
+		fpath := root + "/" + name
+		switch {
+		case strings.HasSuffix(name, "/"):
+		case strings.HasPrefix(content, "->"):
+			vol.Unlink(fpath)
+			err := vol.Symlink(content[2:], fpath)
+			check(t, err == nil, "Symlink %q: %s", fpath, err)
+		case strings.HasPrefix(content, "=>"):
+		default:
+			f, err := vol.Create(fpath)
+			check(t, err == nil, "Create %q: %s", fpath, err)
+			_, err = f.WriteString(content)
+			check(t, err == nil, "WriteString %q: %s", fpath, err)
+			f.Close()
+		}
+	}
+
+	// Hard links need their target to exist.
+	vol.Unlink(root + "/dir/hard")
+	d, err := vol.OpenDir(root + "/dir")
+	check(t, err == nil, "OpenDir %q: %s", root+"/dir", err)
+	defer d.Close()
+	if err := d.Linkat("file", d, "hard", 0); err != nil {
+		delete(expected, "dir/hard")
+	}
+
+	err = vol.Setxattr(root+"/file", "user.tar", []byte("xattr value"), 0)
+	check(t, err == nil, "Setxattr %q: %s", root+"/file", err)
+
+	return expected
+}
+
+// readTar returns the content of each entry of the tar archive r, calling
+// fn with each header.
+func readTar(t *testing.T, r io.Reader, fn func(hdr *tar.Header)) map[string]string {
+	t.Helper()
+
+	found := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return found
+		}
+		check(t, err == nil, "Next: %s", err)
+
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			found[hdr.Name] = "->" + hdr.Linkname
+		case tar.TypeLink:
+			found[hdr.Name] = "=>" + hdr.Linkname
+		default:
+			content, err := io.ReadAll(tr)
+			check(t, err == nil, "ReadAll %q: %s", hdr.Name, err)
+			found[hdr.Name] = string(content)
+		}
+		fn(hdr)
+	}
+}
+
+func TestTarTo(t *testing.T) {
+	root := tmpDir + "/TestTarTo"
+	expected := setupTree(t, root)
+
+	var buf bytes.Buffer
+	err := vol.TarTo(&buf, root)
+	check(t, err == nil, "TarTo %q: %s", root, err)
+
+	found := readTar(t, &buf, func(hdr *tar.Header) {
+		if hdr.Name == "file" {
+			check(t, hdr.PAXRecords[paxXattrPrefix+"user.tar"] == "xattr value",
+				"missing xattr record for %q: %v", hdr.Name, hdr.PAXRecords)
+		}
+	})
+
+	// Which of the two names of the hard link comes first is up to TarTo.
+	if found["dir/file"] == "=>dir/hard" {
+		found["dir/file"], found["dir/hard"] = found["dir/hard"], "=>dir/file"
+	}
+	check(t, reflect.DeepEqual(found, expected), "archive doesn't match %v != %v", found, expected)
+}
+
+func TestUntarFrom(t *testing.T) {
+	root := tmpDir + "/TestUntarFrom"
+	setupTree(t, root)
+
+	var archive bytes.Buffer
+	err := vol.TarTo(&archive, root)
+	check(t, err == nil, "TarTo %q: %s", root, err)
+	original := archive.Bytes()
+
+	dest := tmpDir + "/TestUntarFrom-copy"
+	err = vol.UntarFrom(bytes.NewReader(original), dest)
+	check(t, err == nil, "UntarFrom %q: %s", dest, err)
+
+	var copied bytes.Buffer
+	err = vol.TarTo(&copied, dest)
+	check(t, err == nil, "TarTo %q: %s", dest, err)
+
+	headers := make(map[string]*tar.Header)
+	expected := readTar(t, bytes.NewReader(original), func(hdr *tar.Header) {
+		headers[hdr.Name] = hdr
+	})
+	found := readTar(t, &copied, func(hdr *tar.Header) {
+		orig := headers[hdr.Name]
+		check(t, orig != nil, "unexpected entry %q", hdr.Name)
+		check(t, hdr.Mode == orig.Mode, "%q has mode %#o instead of %#o", hdr.Name, hdr.Mode, orig.Mode)
+		if hdr.Typeflag != tar.TypeSymlink {
+			check(t, hdr.ModTime.Unix() == orig.ModTime.Unix(), "%q has mtime %v instead of %v",
+				hdr.Name, hdr.ModTime, orig.ModTime)
+		}
+		for key, value := range orig.PAXRecords {
+			if strings.HasPrefix(key, paxXattrPrefix) {
+				check(t, hdr.PAXRecords[key] == value, "%q lacks the xattr record %q=%q", hdr.Name, key, value)
+			}
+		}
+	})
+	check(t, reflect.DeepEqual(found, expected), "round trip doesn't match %v != %v", found, expected)
+}
+
+func TestDiskUsage(t *testing.T) {
+	var vbuf Statvfs_t
+	err := vol.Statvfs("/", &vbuf)
+	check(t, err == nil, "Statvfs: %s", err)
+	check(t, vbuf.Files > 0, "Statvfs reported no inodes")
+	check(t, vbuf.Ffree <= vbuf.Files, "more free inodes than inodes %d > %d", vbuf.Ffree, vbuf.Files)
+
+	usage, err := vol.DiskUsage("/")
+	check(t, err == nil, "DiskUsage: %s", err)
+	check(t, usage.Files == uint64(vbuf.Files), "incorrect inode count %d != %d", usage.Files, vbuf.Files)
+	check(t, usage.Size > 0 && usage.Free <= usage.Size, "incorrect space usage %+v", usage)
+}
+
+func TestSetLoggingReadOnlyDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("directory permissions don't apply to root")
+	}
+
+	dir := t.TempDir()
+	err := os.Chmod(dir, 0500)
+	check(t, err == nil, "Chmod %q: %s", dir, err)
+	defer os.Chmod(dir, 0700)
+
+	err = new(Volume).SetLogging(dir+"/gfapi.log", LogDebug)
+	check(t, err != nil, "SetLogging in read-only directory %q succeeded", dir)
+	check(t, strings.Contains(err.Error(), "not writable") && strings.Contains(err.Error(), dir),
+		"uninformative error: %v", err)
+	check(t, errors.Is(err, os.ErrPermission), "error doesn't wrap the permission error: %v", err)
+
+	// Logging to stderr writes nothing to the current directory.
+	wd, err := os.Getwd()
+	check(t, err == nil, "Getwd: %s", err)
+	err = os.Chdir(dir)
+	check(t, err == nil, "Chdir %q: %s", dir, err)
+	defer os.Chdir(wd)
+	err = checkLogFile("-")
+	check(t, err == nil, "checkLogFile of stderr in read-only directory %q: %s", dir, err)
+}
+
+func TestFlush(t *testing.T) {
+	path := tmpDir + "/TestFlush"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+	err = f.Flush()
+	check(t, err == nil, "Flush %q: %s", path, err)
+
+	r, err := vol.Open(path)
+	check(t, err == nil, "Open %q: %s", path, err)
+	defer r.Close()
+
+	buf := make([]byte, len(data))
+	_, err = io.ReadFull(r, buf)
+	check(t, err == nil, "Read %q: %s", path, err)
+	check(t, bytes.Equal(buf, data), "flushed data not visible %q != %q", buf, data)
+}
+
+func TestSyncRange(t *testing.T) {
+	path := tmpDir + "/TestSyncRange"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer f.Close()
+
+	_, err = f.WriteAt(data, 4096)
+	check(t, err == nil, "WriteAt %q: %s", path, err)
+	err = f.SyncRange(4096, int64(len(data)), SYNC_FILE_RANGE_WAIT_BEFORE|SYNC_FILE_RANGE_WRITE|SYNC_FILE_RANGE_WAIT_AFTER)
+	check(t, err == nil, "SyncRange %q: %s", path, err)
+
+	r, err := vol.Open(path)
+	check(t, err == nil, "Open %q: %s", path, err)
+	defer r.Close()
+
+	buf := make([]byte, len(data))
+	_, err = r.ReadAt(buf, 4096)
+	check(t, err == nil, "ReadAt %q: %s", path, err)
+	check(t, bytes.Equal(buf, data), "synced range not visible %q != %q", buf, data)
+
+	err = f.SyncRange(-1, 0, SYNC_FILE_RANGE_WRITE)
+	check(t, errors.Is(err, syscall.EINVAL), "SyncRange with a negative offset %q: %v", path, err)
+	err = f.SyncRange(0, 0, 8)
+	check(t, errors.Is(err, syscall.EINVAL), "SyncRange with unknown flags %q: %v", path, err)
+}
+
+func TestAddVolfileServer(t *testing.T) {
+	v := new(Volume)
+	err := v.Init("test")
+	check(t, err == nil, "Init: %s", err)
+
+	err = v.AddVolfileServer("udp", "localhost", 24007)
+	check(t, err != nil, "AddVolfileServer accepted an invalid transport")
+
+	// Nothing listens on the first port, so the volfile comes from the second server.
+	err = v.AddVolfileServer("tcp", "localhost", 24017)
+	check(t, err == nil, "AddVolfileServer: %s", err)
+	err = v.AddVolfileServer("tcp", "localhost", 24007)
+	check(t, err == nil, "AddVolfileServer: %s", err)
+
+	err = v.Mount()
+	check(t, err == nil, "Mount with an unreachable volfile server: %s", err)
+	v.Unmount()
+}
+
+func TestUnsetVolfileServer(t *testing.T) {
+	v := new(Volume)
+	err := v.Init("test", "localhost")
+	check(t, err == nil, "Init: %s", err)
+	defer v.Unmount()
+
+	err = v.AddVolfileServer("tcp", "localhost", 24017)
+	check(t, err == nil, "AddVolfileServer: %s", err)
+
+	err = v.UnsetVolfileServer("tcp", "localhost", 24017)
+	if !Supports(FeatureUnsetVolfileServer) {
+		check(t, errors.Is(err, ErrUnsupported), "UnsetVolfileServer without library support: %v", err)
+		return
+	}
+	check(t, err == nil, "UnsetVolfileServer: %s", err)
+}
+
+func TestMountRetry(t *testing.T) {
+	defer func(mount, reinit func(*Volume) error) {
+		mountVolume, reinitVolume = mount, reinit
+	}(mountVolume, reinitVolume)
+
+	calls, reinits := 0, 0
+	mountVolume = func(*Volume) error {
+		calls++
+		if calls < 3 {
+			return errors.New("glusterd unavailable")
+		}
+		return nil
+	}
+	reinitVolume = func(*Volume) error {
+		// A failed glfs object must be replaced before each further attempt
+		check(t, reinits == calls-1, "MountRetry reinitialized %d times before attempt %d", reinits, calls+1)
+		reinits++
+		return nil
+	}
+
+	start := time.Now()
+	err := new(Volume).MountRetry(5, time.Millisecond)
+	check(t, err == nil, "MountRetry: %s", err)
+	check(t, calls == 3, "MountRetry made %d attempts instead of 3", calls)
+	check(t, reinits == 2, "MountRetry reinitialized %d times instead of 2", reinits)
+	check(t, time.Since(start) >= 3*time.Millisecond, "MountRetry didn't back off")
+
+	calls, reinits = -10, -10
+	err = new(Volume).MountRetry(2, time.Millisecond)
+	check(t, err != nil && err.Error() == "glusterd unavailable", "MountRetry: %v", err)
+	check(t, calls == -8, "MountRetry made %d attempts instead of 2", calls+10)
+
+	// Attempts stop if no fresh object can be built
+	calls = 0
+	reinitVolume = func(*Volume) error { return errors.New("error creating mount object") }
+	err = new(Volume).MountRetry(5, time.Millisecond)
+	check(t, err != nil && calls == 1, "MountRetry after failed reinit: %d attempts, %v", calls, err)
+
+	err = (&Volume{mounted: true}).Mount()
+	check(t, err != nil, "Mount of a mounted Volume did not fail")
+}
+
+func TestOpenFilePerm(t *testing.T) {
+	path := tmpDir + "/TestOpenFilePerm"
+	vol.Unlink(path)
+
+	f, err := vol.OpenFile(path, os.O_RDWR|os.O_CREATE, 0640)
+	check(t, err == nil, "OpenFile %q: %s", path, err)
+	f.Close()
+	fi, err := vol.Stat(path)
+	check(t, err == nil, "Stat %q: %s", path, err)
+	check(t, fi.Mode().Perm() == 0640, "created file has mode %v instead of 0640", fi.Mode())
+
+	// perm is ignored for an existing file by default.
+	f, err = vol.OpenFile(path, os.O_RDWR, 0600)
+	check(t, err == nil, "OpenFile %q: %s", path, err)
+	f.Close()
+	fi, err = vol.Stat(path)
+	check(t, err == nil, "Stat %q: %s", path, err)
+	check(t, fi.Mode().Perm() == 0640, "existing file's mode changed to %v", fi.Mode())
+
+	f, err = vol.OpenFile(path, os.O_RDWR|O_CHMOD, 0600)
+	check(t, err == nil, "OpenFile %q: %s", path, err)
+	f.Close()
+	fi, err = vol.Stat(path)
+	check(t, err == nil, "Stat %q: %s", path, err)
+	check(t, fi.Mode().Perm() == 0600, "O_CHMOD set mode %v instead of 0600", fi.Mode())
+}
+
+func TestVolumeUmask(t *testing.T) {
+	defer vol.Umask(vol.Umask(027))
+
+	path := tmpDir + "/TestVolumeUmask"
+	vol.Unlink(path)
+	f, err := vol.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	check(t, err == nil, "OpenFile %q: %s", path, err)
+	f.Close()
+	fi, err := vol.Stat(path)
+	check(t, err == nil, "Stat %q: %s", path, err)
+	check(t, fi.Mode() == 0640, "file created with 0666 under umask 027 has mode %v instead of 0640", fi.Mode())
+
+	// Only the permission bits of perm are used.
+	vol.Unlink(path)
+	f, err = vol.OpenFile(path, os.O_RDWR|os.O_CREATE, os.ModeDir|0640)
+	check(t, err == nil, "OpenFile %q: %s", path, err)
+	f.Close()
+	fi, err = vol.Stat(path)
+	check(t, err == nil, "Stat %q: %s", path, err)
+	check(t, fi.Mode() == 0640, "file created with ModeDir|0640 has mode %v instead of 0640", fi.Mode())
+
+	dir := tmpDir + "/TestVolumeUmaskDir"
+	vol.Rmdir(dir)
+	err = vol.Mkdir(dir, 0777)
+	check(t, err == nil, "Mkdir %q: %s", dir, err)
+	fi, err = vol.Stat(dir)
+	check(t, err == nil, "Stat %q: %s", dir, err)
+	check(t, fi.Mode().Perm() == 0750, "directory created with 0777 under umask 027 has mode %v instead of 0750", fi.Mode().Perm())
+
+	_, err = vol.OpenFile(path+"-dir", os.O_RDONLY|os.O_CREATE|syscall.O_DIRECTORY, 0755)
+	check(t, errors.Is(err, ErrInvalidFlags), "OpenFile with O_CREATE|O_DIRECTORY returned %v instead of ErrInvalidFlags", err)
+
+	old := vol.Umask(022)
+	check(t, old == 027, "Umask returned %v instead of 027", old)
+}
+
+func TestReadFile(t *testing.T) {
+	path := tmpDir + "/TestReadFile"
+	content := bytes.Repeat([]byte("gluster"), 10000)
+
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	_, err = f.Write(content)
+	check(t, err == nil, "Write %q: %s", path, err)
+	f.Close()
+
+	read, err := vol.ReadFile(path)
+	check(t, err == nil, "ReadFile %q: %s", path, err)
+	check(t, bytes.Equal(read, content), "ReadFile %q returned %d bytes instead of %d", path, len(read), len(content))
+}
+
+// setupLargeFile creates a file of 64 MiB for the read benchmarks.
+func setupLargeFile(b *testing.B, size int64) string {
+	path := tmpDir + "/BenchmarkLargeFile-" + strconv.FormatInt(size, 10)
+	if fi, err := vol.Stat(path); err == nil && fi.Size() == size {
+		return path
+	}
+
+	f, err := vol.Create(path)
+	if err != nil {
+		b.Fatalf("Create %q: %s", path, err)
+	}
+	defer f.Close()
+
+	chunk := make([]byte, 1<<20)
+	for n := int64(0); n < size; n += int64(len(chunk)) {
+		if _, err := f.Write(chunk[:min(int64(len(chunk)), size-n)]); err != nil {
+			b.Fatalf("Write %q: %s", path, err)
+		}
+	}
+	return path
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	path := tmpDir + "/TestOpenReadOnly"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", path, err)
+	f.Close()
+
+	f, err = vol.OpenReadOnly(path)
+	check(t, err == nil, "OpenReadOnly %q: %s", path, err)
+	defer f.Close()
+	check(t, !f.isDir, "OpenReadOnly %q: opened as a directory", path)
+
+	buf, err := io.ReadAll(f)
+	check(t, err == nil && bytes.Equal(buf, data), "ReadAll %q: %q, %v", path, buf, err)
+	_, err = f.Write(data)
+	check(t, err != nil, "Write to a file opened with OpenReadOnly %q succeeded", path)
+
+	_, err = vol.OpenReadOnly(path + "-missing")
+	check(t, errors.Is(err, fs.ErrNotExist), "OpenReadOnly of a missing file returned %v", err)
+}
+
+func benchmarkOpen(b *testing.B, open func(string) (*File, error)) {
+	path := tmpDir + "/benchmarkOpen"
+	f, err := vol.Create(path)
+	if err != nil {
+		b.Fatalf("Create %q: %s", path, err)
+	}
+	f.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		f, err := open(path)
+		if err != nil {
+			b.Fatalf("open %q: %s", path, err)
+		}
+		f.Close()
+	}
+}
+
+func BenchmarkOpen(b *testing.B) {
+	benchmarkOpen(b, vol.Open)
+}
+
+func BenchmarkOpenReadOnly(b *testing.B) {
+	benchmarkOpen(b, vol.OpenReadOnly)
+}
+
+func TestChecksum(t *testing.T) {
+	path := tmpDir + "/TestChecksum"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	_, err = f.WriteString("The quick brown fox jumps over the lazy dog")
+	check(t, err == nil, "WriteString %q: %s", path, err)
+	f.Close()
+
+	f, err = vol.Open(path)
+	check(t, err == nil, "Open %q: %s", path, err)
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := f.Checksum(h)
+	check(t, err == nil, "Checksum %q: %s", path, err)
+	check(t, n == 43, "Checksum %q read %d bytes instead of 43", path, n)
+
+	want := "d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592"
+	got := hex.EncodeToString(h.Sum(nil))
+	check(t, got == want, "Checksum %q: %s != %s", path, got, want)
+}
+
+func TestFileChecksum(t *testing.T) {
+	path := tmpDir + "/TestFileChecksum"
+	content := bytes.Repeat([]byte("gluster"), 100000)
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	_, err = f.Write(content)
+	check(t, err == nil, "Write %q: %s", path, err)
+	f.Close()
+
+	sum, err := vol.FileChecksum(path, sha256.New())
+	check(t, err == nil, "FileChecksum %q: %s", path, err)
+	want := sha256.Sum256(content)
+	check(t, bytes.Equal(sum, want[:]), "FileChecksum %q: %x != %x", path, sum, want)
+
+	_, err = vol.FileChecksum(path+"-missing", sha256.New())
+	check(t, errors.Is(err, fs.ErrNotExist), "FileChecksum of a missing file returned %v", err)
+}
+
+func BenchmarkReadFile(b *testing.B) {
+	path := setupLargeFile(b, 64<<20)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := vol.ReadFile(path); err != nil {
+			b.Fatalf("ReadFile %q: %s", path, err)
+		}
+	}
+}
+
+func BenchmarkReadFileNaive(b *testing.B) {
+	path := setupLargeFile(b, 64<<20)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		f, err := vol.Open(path)
+		if err != nil {
+			b.Fatalf("Open %q: %s", path, err)
+		}
+		if _, err := io.ReadAll(f); err != nil {
+			b.Fatalf("ReadAll %q: %s", path, err)
+		}
+		f.Close()
+	}
+}
+
+func TestStatName(t *testing.T) {
+	dir := tmpDir + "/TestStatName/a/b"
+	err := vol.MkdirAll(dir, 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+
+	f, err := vol.Create(dir + "/c")
+	check(t, err == nil, "Create %q: %s", dir+"/c", err)
+	defer f.Close()
+
+	fi, err := vol.Stat(dir + "/c")
+	check(t, err == nil, "Stat %q: %s", dir+"/c", err)
+	check(t, fi.Name() == "c", "Stat returned name %q instead of %q", fi.Name(), "c")
+
+	fi, err = vol.Lstat(dir + "/c")
+	check(t, err == nil, "Lstat %q: %s", dir+"/c", err)
+	check(t, fi.Name() == "c", "Lstat returned name %q instead of %q", fi.Name(), "c")
+
+	fi, err = f.Stat()
+	check(t, err == nil, "File.Stat %q: %s", dir+"/c", err)
+	check(t, fi.Name() == "c", "File.Stat returned name %q instead of %q", fi.Name(), "c")
+
+	fi, err = vol.Stat(dir + "/")
+	check(t, err == nil, "Stat %q: %s", dir+"/", err)
+	check(t, fi.Name() == "b", "Stat returned name %q instead of %q", fi.Name(), "b")
+}
+
+func TestNotMounted(t *testing.T) {
+	v := new(Volume)
+	err := v.Init("test", "localhost")
+	check(t, err == nil, "Init: %s", err)
+	defer v.Unmount()
+
+	_, err = v.Stat("/")
+	check(t, errors.Is(err, ErrNotMounted), "Stat on an unmounted volume returned %v instead of ErrNotMounted", err)
+
+	_, err = v.Create("/TestNotMounted")
+	check(t, errors.Is(err, ErrNotMounted), "Create on an unmounted volume returned %v instead of ErrNotMounted", err)
+}
+
+func TestGetxattrValue(t *testing.T) {
+	name := tmpDir + "/TestGetxattrValue"
+	f, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	defer f.Close()
+
+	err = f.Setxattr("user.glusterfs", []byte("Gluster is awesome!"), 0)
+	check(t, err == nil, "Setxattr %q: %s", name, err)
+
+	size, err := f.Getxattr("user.glusterfs", nil)
+	check(t, err == nil, "Getxattr %q: %s", name, err)
+	buf := make([]byte, size)
+	size, err = f.Getxattr("user.glusterfs", buf)
+	check(t, err == nil, "Getxattr %q: %s", name, err)
+
+	value, err := f.GetxattrValue("user.glusterfs")
+	check(t, err == nil, "GetxattrValue %q: %s", name, err)
+	check(t, bytes.Equal(value, buf[:size]), "GetxattrValue returned %q instead of %q", value, buf[:size])
+
+	_, err = f.GetxattrValue("user.absent")
+	check(t, errors.Is(err, ErrNoXattr), "GetxattrValue of an absent attribute returned %v instead of ErrNoXattr", err)
+}
+
+func TestXattrSize(t *testing.T) {
+	name := tmpDir + "/TestXattrSize"
+	f, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	f.Close()
+
+	value := []byte("Gluster is awesome!")
+	err = vol.Setxattr(name, "user.glusterfs", value, 0)
+	check(t, err == nil, "Setxattr %q: %s", name, err)
+
+	size, err := vol.XattrSize(name, "user.glusterfs")
+	check(t, err == nil, "XattrSize %q: %s", name, err)
+	check(t, size == int64(len(value)), "XattrSize returned %d instead of %d", size, len(value))
+
+	_, err = vol.XattrSize(name, "user.absent")
+	check(t, errors.Is(err, ErrNoXattr), "XattrSize of an absent attribute returned %v instead of ErrNoXattr", err)
+}
+
+func TestWriteFileWithXattrs(t *testing.T) {
+	dir := tmpDir + "/TestWriteFileWithXattrs"
+	err := vol.MkdirAll(dir, 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+	name := dir + "/config"
+
+	xattrs := map[string][]byte{
+		"user.version": []byte("2"),
+		"user.owner":   []byte("team"),
+		"user.empty":   {},
+	}
+	for _, content := range []string{"first", "second"} {
+		err = vol.WriteFileWithXattrs(name, []byte(content), 0640, xattrs)
+		check(t, err == nil, "WriteFileWithXattrs %q: %s", name, err)
+
+		got, err := vol.ReadFile(name)
+		check(t, err == nil && string(got) == content, "ReadFile %q: %q, %v", name, got, err)
+	}
+	defer vol.Unlink(name)
+
+	fi, err := vol.Stat(name)
+	check(t, err == nil, "Stat %q: %s", name, err)
+	check(t, fi.Mode().Perm() == 0640, "WriteFileWithXattrs %q: mode %v != %v", name, fi.Mode().Perm(), os.FileMode(0640))
+
+	for attr, want := range xattrs {
+		value, err := vol.GetxattrValue(name, attr)
+		check(t, err == nil && bytes.Equal(value, want), "GetxattrValue %q %s: %q, %v", name, attr, value, err)
+	}
+
+	names, err := vol.ReadDirNames(dir)
+	check(t, err == nil && reflect.DeepEqual(names, []string{"config"}), "WriteFileWithXattrs %q left %v behind, %v", name, names, err)
+}
+
+func TestGetAllXattrs(t *testing.T) {
+	name := tmpDir + "/TestGetAllXattrs"
+	f, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	f.Close()
+
+	want := map[string][]byte{
+		"user.one":   []byte("1"),
+		"user.two":   []byte("two"),
+		"user.three": []byte("three 3"),
+	}
+	for attr, value := range want {
+		err = vol.Setxattr(name, attr, value, 0)
+		check(t, err == nil, "Setxattr %q %q: %s", name, attr, err)
+	}
+
+	attrs, err := vol.GetAllXattrs(name)
+	check(t, err == nil, "GetAllXattrs %q: %s", name, err)
+	for attr, value := range want {
+		check(t, bytes.Equal(attrs[attr], value), "GetAllXattrs returned %q for %q instead of %q", attrs[attr], attr, value)
+	}
+}
+
+func TestSetAllXattrs(t *testing.T) {
+	name := tmpDir + "/TestSetAllXattrs"
+	f, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	f.Close()
+
+	attrs := map[string][]byte{
+		"user.one":   []byte("1"),
+		"user.two":   []byte("two"),
+		"user.three": []byte("three 3"),
+	}
+	errs := vol.SetAllXattrs(name, attrs, 0)
+	check(t, len(errs) == 0, "SetAllXattrs %q: %v", name, errs)
+
+	for attr, value := range attrs {
+		buf := make([]byte, 64)
+		n, err := vol.Getxattr(name, attr, buf)
+		check(t, err == nil, "Getxattr %q %q: %s", name, attr, err)
+		check(t, bytes.Equal(buf[:n], value), "Getxattr returned %q for %q instead of %q", buf[:n], attr, value)
+	}
+
+	const xattrCreate = 0x1 // XATTR_CREATE
+	errs = vol.SetAllXattrs(name, map[string][]byte{"user.one": []byte("x"), "user.four": []byte("4")}, xattrCreate)
+	check(t, len(errs) == 1 && errors.Is(errs[0], syscall.EEXIST), "SetAllXattrs with XATTR_CREATE returned %v instead of one EEXIST error", errs)
+}
+
+func TestPreallocate(t *testing.T) {
+	name := tmpDir + "/TestPreallocate"
+	size := int64(1 << 20)
+
+	err := vol.Preallocate(name, size)
+	check(t, err == nil, "Preallocate %q: %s", name, err)
+
+	fi, err := vol.Stat(name)
+	check(t, err == nil, "Stat %q: %s", name, err)
+	check(t, fi.Size() == size, "Stat returned size %d instead of %d", fi.Size(), size)
+
+	err = vol.Preallocate(name, -1)
+	check(t, errors.Is(err, ErrNegativeSize), "Preallocate with a negative size returned %v instead of ErrNegativeSize", err)
+}
+
+// countingReader returns zeros, as much as asked for, until size bytes have
+// been read, and counts the calls to Read.
+type countingReader struct {
+	size  int64
+	reads int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.reads++
+	if r.size == 0 {
+		return 0, io.EOF
+	}
+	n := int(min(int64(len(p)), r.size))
+	clear(p[:n])
+	r.size -= int64(n)
+	return n, nil
+}
+
+func TestSequentialReaderReads(t *testing.T) {
+	const size, bufSize = 8 << 20, 1 << 20
+	for _, dst := range []io.Writer{io.Discard, new(bytes.Buffer)} {
+		src := &countingReader{size: size}
+		n, err := io.Copy(dst, sequentialReader(src, bufSize))
+		check(t, n == size && err == nil, "Copy to %T: %d, %v", dst, n, err)
+		check(t, src.reads <= size/bufSize+1, "Copy to %T read %d times instead of at most %d", dst, src.reads, size/bufSize+1)
+	}
+}
+
+func benchmarkStream(b *testing.B, reader func(f *File) io.Reader) {
+	path := setupLargeFile(b, 1<<30)
+	b.SetBytes(1 << 30)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		f, err := vol.Open(path)
+		if err != nil {
+			b.Fatalf("Open %q: %s", path, err)
+		}
+		if _, err := io.Copy(io.Discard, reader(f)); err != nil {
+			b.Fatalf("Copy %q: %s", path, err)
+		}
+		f.Close()
+	}
+}
+
+func BenchmarkStreamDefault(b *testing.B) {
+	benchmarkStream(b, func(f *File) io.Reader { return f })
+}
+
+func BenchmarkStreamSequentialReader(b *testing.B) {
+	benchmarkStream(b, func(f *File) io.Reader { return f.SequentialReader(0) })
+}
+
+func TestWalkParallel(t *testing.T) {
+	base := tmpDir + "/TestWalkParallel"
+	expected := map[string]bool{base: true}
+	for i := 0; i < 10; i++ {
+		dir := base + "/dir" + strconv.Itoa(i)
+		err := vol.MkdirAll(dir, 0755)
+		check(t, err == nil, "MkdirAll %q: %s", dir, err)
+		expected[dir] = true
+
+		for j := 0; j < 20; j++ {
+			name := dir + "/file" + strconv.Itoa(j)
+			f, err := vol.Create(name)
+			check(t, err == nil, "Create %q: %s", name, err)
+			f.Close()
+			expected[name] = false
+		}
+	}
+
+	// The callback runs on the worker goroutines, where t.Fatalf must not be
+	// called, so only record what it sees and check it afterwards.
+	var mu sync.Mutex
+	visited := make(map[string]int)
+	isDir := make(map[string]bool)
+	err := vol.WalkParallel(base, 8, func(name string, info os.FileInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		visited[name]++
+		isDir[name] = info.IsDir()
+	})
+	check(t, err == nil, "WalkParallel %q: %s", base, err)
+
+	check(t, len(visited) == len(expected), "WalkParallel visited %d entries instead of %d", len(visited), len(expected))
+	for name, n := range visited {
+		dir, ok := expected[name]
+		check(t, ok, "WalkParallel visited unexpected %q", name)
+		check(t, n == 1, "WalkParallel visited %q %d times", name, n)
+		check(t, isDir[name] == dir, "WalkParallel returned IsDir %v for %q", isDir[name], name)
+	}
+}
+
+func TestOffset(t *testing.T) {
+	path := tmpDir + "/TestOffset"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer f.Close()
+
+	off, err := f.Offset()
+	check(t, err == nil && off == 0, "Offset of a new file %q: %d, %v", path, off, err)
+
+	n, err := f.WriteString("0123456789")
+	check(t, err == nil, "WriteString %q: %s", path, err)
+	off, err = f.Offset()
+	check(t, err == nil && off == int64(n), "Offset %q after writing %d bytes: %d, %v", path, n, off, err)
+
+	off, err = f.Offset()
+	check(t, err == nil && off == int64(n), "Offset %q moved the offset: %d, %v", path, off, err)
+}
+
+func TestTruncateFill(t *testing.T) {
+	const size = 1 << 20
+	for _, fill := range []bool{false, true} {
+		path := tmpDir + "/TestTruncateFill-" + strconv.FormatBool(fill)
+		f, err := vol.Create(path)
+		check(t, err == nil, "Create %q: %s", path, err)
+		f.Close()
+
+		err = vol.TruncateFill(path, size, fill)
+		check(t, err == nil, "TruncateFill %q: %s", path, err)
+
+		fi, err := vol.Stat(path)
+		check(t, err == nil, "Stat %q: %s", path, err)
+		check(t, fi.Size() == size, "TruncateFill %q: size %d != %d", path, fi.Size(), size)
+
+		f, err = vol.Open(path)
+		check(t, err == nil, "Open %q: %s", path, err)
+		hole, err := f.Seek(0, SEEK_HOLE)
+		f.Close()
+		if errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOTSUP) {
+			t.Skipf("SEEK_HOLE not supported: %s", err)
+		}
+		check(t, err == nil, "Seek SEEK_HOLE %q: %s", path, err)
+		if fill {
+			check(t, hole == size, "TruncateFill %q with fill left a hole at %d", path, hole)
+		} else {
+			check(t, hole == 0, "TruncateFill %q without fill didn't leave a hole, SEEK_HOLE returned %d", path, hole)
+		}
+	}
+
+	path := tmpDir + "/TestTruncateFill-false"
+	err := vol.Truncate(path, 10)
+	check(t, err == nil, "Truncate %q: %s", path, err)
+	fi, err := vol.Stat(path)
+	check(t, err == nil, "Stat %q: %s", path, err)
+	check(t, fi.Size() == 10, "Truncate %q: size %d != 10", path, fi.Size())
+}
+
+func TestSeekInvalid(t *testing.T) {
+	path := tmpDir + "/TestSeekInvalid"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer f.Close()
+
+	_, err = f.WriteString("0123456789")
+	check(t, err == nil, "WriteString %q: %s", path, err)
+
+	_, err = f.Seek(0, 42)
+	check(t, errors.Is(err, syscall.EINVAL), "Seek with an invalid whence %q returned %v instead of EINVAL", path, err)
+
+	_, err = f.Seek(-1, io.SeekStart)
+	check(t, errors.Is(err, syscall.EINVAL), "Seek to -1 %q returned %v instead of EINVAL", path, err)
+
+	_, err = f.Seek(-20, io.SeekEnd)
+	check(t, errors.Is(err, syscall.EINVAL), "Seek before the start %q returned %v instead of EINVAL", path, err)
+
+	off, err := f.Seek(-4, io.SeekEnd)
+	check(t, err == nil && off == 6, "Seek 4 bytes before the end %q: %d, %v", path, off, err)
+}
+
+func TestReadAtEOF(t *testing.T) {
+	path := tmpDir + "/TestReadAtEOF"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer f.Close()
+
+	_, err = f.WriteString("0123456789")
+	check(t, err == nil, "WriteString %q: %s", path, err)
+
+	buf := make([]byte, 4)
+	n, err := f.ReadAt(buf, 6)
+	check(t, n == 4 && err == nil && string(buf) == "6789", "ReadAt exactly to EOF %q: %d, %q, %v", path, n, buf[:n], err)
+
+	n, err = f.ReadAt(buf, 8)
+	check(t, n == 2 && err == io.EOF && string(buf[:n]) == "89", "ReadAt across EOF %q: %d, %q, %v", path, n, buf[:n], err)
+
+	n, err = f.ReadAt(buf, 10)
+	check(t, n == 0 && err == io.EOF, "ReadAt at EOF %q: %d, %v", path, n, err)
+
+	n, err = f.ReadAt(buf, 20)
+	check(t, n == 0 && err == io.EOF, "ReadAt beyond EOF %q: %d, %v", path, n, err)
+}
+
+func TestCreateMode(t *testing.T) {
+	defer vol.Umask(vol.Umask(0))
+
+	path := tmpDir + "/TestCreateMode"
+	vol.Unlink(path)
+	f, err := vol.CreateMode(path, 0600)
+	check(t, err == nil, "CreateMode %q: %s", path, err)
+	f.Close()
+
+	fi, err := vol.Stat(path)
+	check(t, err == nil, "Stat %q: %s", path, err)
+	check(t, fi.Mode().Perm() == 0600, "CreateMode created %q with mode %v instead of 0600", path, fi.Mode().Perm())
+}
+
+func TestVolumeReadDir(t *testing.T) {
+	dir := tmpDir + "/TestVolumeReadDir"
+	err := vol.MkdirAll(dir+"/b", 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir+"/b", err)
+	for _, name := range []string{"c", "a"} {
+		f, err := vol.Create(dir + "/" + name)
+		check(t, err == nil, "Create %q: %s", dir+"/"+name, err)
+		f.Close()
+	}
+	vol.Symlink("a", dir+"/d")
+
+	entries, err := vol.ReadDir(dir)
+	check(t, err == nil, "ReadDir %q: %s", dir, err)
+
+	expected := []struct {
+		name string
+		typ  fs.FileMode
+	}{{"a", 0}, {"b", fs.ModeDir}, {"c", 0}, {"d", fs.ModeSymlink}}
+	check(t, len(entries) == len(expected), "ReadDir returned %d entries instead of %d", len(entries), len(expected))
+	for i, e := range entries {
+		check(t, e.Name() == expected[i].name, "ReadDir returned %q instead of %q at %d", e.Name(), expected[i].name, i)
+		check(t, e.Type() == expected[i].typ, "ReadDir returned type %v instead of %v for %q", e.Type(), expected[i].typ, e.Name())
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+	defer SetBufferSize(defaultBufferSize)
+
+	SetBufferSize(64 << 10)
+	buf := buffers.get()
+	check(t, len(*buf) == 64<<10, "get returned %d bytes instead of %d", len(*buf), 64<<10)
+	buffers.put(buf)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		buffers.put(buffers.get())
+	})
+	check(t, allocs == 0, "get allocated %v times per run with a warm pool", allocs)
+
+	SetBufferSize(1)
+	buf = buffers.get()
+	check(t, len(*buf) == minBufferSize, "get returned %d bytes instead of the minimum %d", len(*buf), minBufferSize)
+}
+
+func TestCopyFile(t *testing.T) {
+	src := tmpDir + "/TestCopyFile-src"
+	dst := tmpDir + "/TestCopyFile-dst"
+	content := bytes.Repeat([]byte("0123456789"), 100000)
+
+	f, err := vol.CreateMode(src, 0640)
+	check(t, err == nil, "CreateMode %q: %s", src, err)
+	_, err = f.Write(content)
+	check(t, err == nil, "Write %q: %s", src, err)
+	f.Close()
+
+	n, err := vol.CopyFile(src, dst)
+	check(t, err == nil, "CopyFile %q: %s", src, err)
+	check(t, n == int64(len(content)), "CopyFile copied %d bytes instead of %d", n, len(content))
+
+	data, err := vol.ReadFile(dst)
+	check(t, err == nil, "ReadFile %q: %s", dst, err)
+	check(t, bytes.Equal(data, content), "CopyFile produced different content")
+}
+
+func benchmarkCopyFileParallel(b *testing.B, copyFile func(src, dst string) error) {
+	src := setupLargeFile(b, 4<<20)
+	var seq int64
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		dst := tmpDir + "/BenchmarkCopyFile-" + strconv.FormatInt(atomic.AddInt64(&seq, 1), 10)
+		for pb.Next() {
+			if err := copyFile(src, dst); err != nil {
+				b.Fatalf("copy %q: %s", src, err)
+			}
+		}
+	})
+}
+
+func BenchmarkCopyFileParallel(b *testing.B) {
+	benchmarkCopyFileParallel(b, func(src, dst string) error {
+		_, err := vol.CopyFile(src, dst)
+		return err
+	})
+}
+
+func BenchmarkCopyFileParallelUnpooled(b *testing.B) {
+	benchmarkCopyFileParallel(b, func(src, dst string) error {
+		in, err := vol.Open(src)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := vol.Create(dst)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		_, err = io.CopyBuffer(out, in, make([]byte, defaultBufferSize))
+		return err
+	})
+}
+
+func TestUnmountWaitsForOps(t *testing.T) {
+	v := new(Volume)
+	err := v.Init("test", "localhost")
+	check(t, err == nil, "Init: %s", err)
+
+	v.ops.begin()
+	err = v.UnmountTimeout(10 * time.Millisecond)
+	check(t, errors.Is(err, syscall.EBUSY), "UnmountTimeout with an operation running returned %v instead of EBUSY", err)
+
+	done := make(chan error)
+	go func() {
+		done <- v.UnmountTimeout(time.Minute)
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("UnmountTimeout returned %v before the operation completed", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	v.ops.end()
+	select {
+	case <-done:
+	case <-time.After(time.Minute):
+		t.Fatalf("UnmountTimeout did not return after the operation completed")
+	}
+	check(t, v.fs == nil, "UnmountTimeout did not free the glfs object")
+}
+
+func TestStatErrors(t *testing.T) {
+	dir := tmpDir + "/TestStatErrors"
+	err := vol.MkdirAll(dir+"/locked", 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir+"/locked", err)
+
+	for _, stat := range []func(string) (os.FileInfo, error){vol.Stat, vol.Lstat} {
+		_, err = stat(dir + "/missing")
+		var perr *os.PathError
+		check(t, errors.As(err, &perr), "stat of a missing path returned %T instead of *os.PathError", err)
+		check(t, errors.Is(err, fs.ErrNotExist), "stat of a missing path returned %v, which is not fs.ErrNotExist", err)
+	}
+
+	if os.Geteuid() == 0 {
+		t.Log("running as root, which is never denied permission")
+		return
+	}
+	err = vol.Chmod(dir+"/locked", 0)
+	check(t, err == nil, "Chmod %q: %s", dir+"/locked", err)
+	defer vol.Chmod(dir+"/locked", 0755)
+
+	_, err = vol.Stat(dir + "/locked/file")
+	check(t, errors.Is(err, fs.ErrPermission), "stat below an inaccessible directory returned %v, which is not fs.ErrPermission", err)
+}
+
+func TestAbsName(t *testing.T) {
+	dir := tmpDir + "/TestAbsName"
+	err := vol.MkdirAll(dir, 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+
+	err = vol.Chdir(dir)
+	check(t, err == nil, "Chdir %q: %s", dir, err)
+	defer vol.Chdir("/")
+
+	cwd, err := vol.Getwd()
+	check(t, err == nil && cwd == dir, "Getwd returned %q, %v instead of %q", cwd, err, dir)
+
+	f, err := vol.Create("file")
+	check(t, err == nil, "Create %q: %s", "file", err)
+	defer f.Close()
+	check(t, f.Name() == "file", "Name returned %q instead of %q", f.Name(), "file")
+
+	name, err := f.AbsName()
+	check(t, err == nil, "AbsName %q: %s", f.Name(), err)
+	check(t, name == dir+"/file", "AbsName returned %q instead of %q", name, dir+"/file")
+}
+
+func TestFileChtimes(t *testing.T) {
+	path := tmpDir + "/TestFileChtimes"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer f.Close()
+
+	atime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	mtime := time.Date(2002, 3, 4, 5, 6, 7, 0, time.UTC)
+	err = f.Chtimes(atime, mtime)
+	check(t, err == nil, "Chtimes %q: %s", path, err)
+
+	var st syscall.Stat_t
+	err = f.glfs.Fstat(&st)
+	check(t, err == nil, "Fstat %q: %s", path, err)
+	check(t, timespecToTime(getLastAccess(&st)).Equal(atime), "Chtimes set atime %v instead of %v", timespecToTime(getLastAccess(&st)), atime)
+	check(t, timespecToTime(getLastModification(&st)).Equal(mtime), "Chtimes set mtime %v instead of %v", timespecToTime(getLastModification(&st)), mtime)
+}
+
+func TestUtimensOmit(t *testing.T) {
+	path := tmpDir + "/TestUtimensOmit"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer f.Close()
+
+	atime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	mtime := time.Date(2002, 3, 4, 5, 6, 7, 0, time.UTC)
+	err = vol.Utimens(path, atime, mtime)
+	check(t, err == nil, "Utimens %q: %s", path, err)
+
+	mtime = mtime.Add(time.Hour)
+	err = f.Futimens(TimeOmit, mtime)
+	check(t, err == nil, "Futimens %q: %s", path, err)
+
+	var st syscall.Stat_t
+	err = f.glfs.Fstat(&st)
+	check(t, err == nil, "Fstat %q: %s", path, err)
+	check(t, timespecToTime(getLastAccess(&st)).Equal(atime), "Futimens with TimeOmit changed atime to %v", timespecToTime(getLastAccess(&st)))
+	check(t, timespecToTime(getLastModification(&st)).Equal(mtime), "Futimens set mtime %v instead of %v", timespecToTime(getLastModification(&st)), mtime)
+
+	before := time.Now().Add(-time.Minute)
+	err = vol.Utimens(path, TimeOmit, TimeNow)
+	check(t, err == nil, "Utimens %q: %s", path, err)
+	err = f.glfs.Fstat(&st)
+	check(t, err == nil, "Fstat %q: %s", path, err)
+	check(t, timespecToTime(getLastAccess(&st)).Equal(atime), "Utimens with TimeOmit changed atime to %v", timespecToTime(getLastAccess(&st)))
+	check(t, timespecToTime(getLastModification(&st)).After(before), "Utimens with TimeNow set mtime %v", timespecToTime(getLastModification(&st)))
+}
+
+func TestOpenDanglingSymlink(t *testing.T) {
+	dir := tmpDir + "/TestOpenDanglingSymlink"
+	err := vol.MkdirAll(dir, 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+
+	link := dir + "/link"
+	vol.Unlink(link)
+	err = vol.Symlink("missing-target", link)
+	check(t, err == nil, "Symlink %q: %s", link, err)
+
+	_, err = vol.Open(link)
+	check(t, errors.Is(err, fs.ErrNotExist), "Open of a dangling symlink returned %v, which is not fs.ErrNotExist", err)
+	check(t, strings.Contains(err.Error(), "missing-target"), "Open of a dangling symlink returned %q, which does not name the target", err)
+
+	_, err = vol.Open(dir + "/missing")
+	check(t, errors.Is(err, fs.ErrNotExist), "Open of a missing file returned %v, which is not fs.ErrNotExist", err)
+	check(t, !strings.Contains(err.Error(), "symbolic link"), "Open of a missing file returned %q, which mentions a symbolic link", err)
+}
+
+func TestCopyRange(t *testing.T) {
+	srcPath := tmpDir + "/TestCopyRange-src"
+	dstPath := tmpDir + "/TestCopyRange-dst"
+
+	src, err := vol.Create(srcPath)
+	check(t, err == nil, "Create %q: %s", srcPath, err)
+	defer src.Close()
+	_, err = src.WriteString("0123456789")
+	check(t, err == nil, "WriteString %q: %s", srcPath, err)
+
+	dst, err := vol.Create(dstPath)
+	check(t, err == nil, "Create %q: %s", dstPath, err)
+	defer dst.Close()
+	_, err = dst.WriteString("abcdefghij")
+	check(t, err == nil, "WriteString %q: %s", dstPath, err)
+
+	n, err := vol.CopyRange(dst, 2, src, 5, 3)
+	check(t, err == nil && n == 3, "CopyRange %q to %q: %d, %v", srcPath, dstPath, n, err)
+
+	n, err = vol.CopyRange(dst, 8, src, 8, 10)
+	check(t, err == nil && n == 2, "CopyRange past the end of %q: %d, %v", srcPath, n, err)
+
+	data, err := vol.ReadFile(dstPath)
+	check(t, err == nil, "ReadFile %q: %s", dstPath, err)
+	check(t, string(data) == "ab567fgh89", "CopyRange produced %q instead of %q", data, "ab567fgh89")
+}
+
+func TestRemove(t *testing.T) {
+	dir := tmpDir + "/TestRemove"
+	err := vol.MkdirAll(dir+"/empty", 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir+"/empty", err)
+	err = vol.MkdirAll(dir+"/full", 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir+"/full", err)
+	for _, name := range []string{dir + "/file", dir + "/full/file"} {
+		f, err := vol.Create(name)
+		check(t, err == nil, "Create %q: %s", name, err)
+		f.Close()
+	}
+
+	err = vol.Remove(dir + "/file")
+	check(t, err == nil, "Remove file %q: %s", dir+"/file", err)
+	_, err = vol.Lstat(dir + "/file")
+	check(t, errors.Is(err, fs.ErrNotExist), "Remove left %q behind: %v", dir+"/file", err)
+
+	err = vol.Remove(dir + "/empty")
+	check(t, err == nil, "Remove empty directory %q: %s", dir+"/empty", err)
+	_, err = vol.Lstat(dir + "/empty")
+	check(t, errors.Is(err, fs.ErrNotExist), "Remove left %q behind: %v", dir+"/empty", err)
+
+	err = vol.Remove(dir + "/full")
+	check(t, errors.Is(err, syscall.ENOTEMPTY), "Remove of non-empty directory %q returned %v instead of ENOTEMPTY", dir+"/full", err)
+
+	err = vol.Remove(dir + "/missing")
+	check(t, errors.Is(err, fs.ErrNotExist), "Remove of missing %q returned %v", dir+"/missing", err)
+}
+
+func TestLockPath(t *testing.T) {
+	v := new(Volume)
+	var (
+		wg      sync.WaitGroup
+		holders int32
+		count   int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := "/dir/file"
+			if i%2 == 0 {
+				name = "/dir//file/"
+			}
+			unlock := v.LockPath(name)
+			defer unlock()
+
+			if atomic.AddInt32(&holders, 1) != 1 {
+				t.Errorf("LockPath %q held by more than one goroutine", name)
+			}
+			count++
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&holders, -1)
+		}(i)
+	}
+	wg.Wait()
+
+	check(t, count == 50, "LockPath let %d goroutines in instead of 50", count)
+	check(t, len(v.pathLocks.locks) == 0, "LockPath left %d locks in the registry", len(v.pathLocks.locks))
+}
+
+func TestPwritevPreadv(t *testing.T) {
+	path := tmpDir + "/TestPwritevPreadv"
+	vol.Unlink(path)
+
+	bufs := [][]byte{[]byte("first "), []byte("second "), []byte("third")}
+	n, err := vol.Pwritev(path, bufs, 4, 0644)
+	check(t, err == nil && n == 18, "Pwritev %q: %d, %v", path, n, err)
+
+	data, err := vol.ReadFile(path)
+	check(t, err == nil, "ReadFile %q: %s", path, err)
+	check(t, string(data) == "\x00\x00\x00\x00first second third", "Pwritev wrote %q", data)
+
+	a, b := make([]byte, 6), make([]byte, 12)
+	n, err = vol.Preadv(path, [][]byte{a, nil, b}, 4)
+	check(t, err == nil && n == 18, "Preadv %q: %d, %v", path, n, err)
+	check(t, string(a) == "first " && string(b) == "second third", "Preadv read %q and %q", a, b)
+}
+
+func TestParseFileMode(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		mode os.FileMode
+	}{
+		{"0755", 0755},
+		{"644", 0644},
+		{"4750", os.ModeSetuid | 0750},
+		{"01777", os.ModeSticky | 0777},
+	} {
+		mode, err := ParseFileMode(tc.s)
+		check(t, err == nil && mode == tc.mode, "ParseFileMode(%q) returned %v, %v instead of %v", tc.s, mode, err, tc.mode)
+	}
+
+	for _, s := range []string{"", "rwxr-xr-x", "0778", "-644", "10000"} {
+		_, err := ParseFileMode(s)
+		check(t, err != nil, "ParseFileMode(%q) did not fail", s)
+	}
+}
+
+func TestChmodString(t *testing.T) {
+	path := tmpDir + "/TestChmodString"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	f.Close()
+
+	err = vol.ChmodString(path, "0640")
+	check(t, err == nil, "ChmodString %q: %s", path, err)
+	fi, err := vol.Stat(path)
+	check(t, err == nil, "Stat %q: %s", path, err)
+	check(t, fi.Mode().Perm() == 0640, "ChmodString set mode %v instead of 0640", fi.Mode().Perm())
+
+	err = vol.ChmodString(path, "bogus")
+	check(t, err != nil, "ChmodString %q with an invalid mode did not fail", path)
+}
+
+func TestTuneXlators(t *testing.T) {
+	v := new(Volume)
+	err := v.Init("test", "localhost")
+	check(t, err == nil, "Init: %s", err)
+	defer v.Unmount()
+
+	err = v.TuneReadahead(true, 8)
+	check(t, err == nil, "TuneReadahead: %s", err)
+	err = v.TuneWriteBehind(false, 0)
+	check(t, err == nil, "TuneWriteBehind: %s", err)
+
+	err = v.Mount()
+	check(t, err == nil, "Mount: %s", err)
+	err = v.TuneWriteBehind(true, 1<<20)
+	check(t, err != nil, "TuneWriteBehind after Mount did not fail")
+}
+
+func TestXattrPermission(t *testing.T) {
+	err := xattrError("trusted.glusterfs.test", syscall.EPERM)
+	check(t, errors.Is(err, ErrXattrPermission) && errors.Is(err, syscall.EPERM), "xattrError returned %v, which is not ErrXattrPermission and EPERM", err)
+	check(t, strings.Contains(err.Error(), "trusted.*"), "xattrError returned %q, which does not name the namespace", err)
+	err = xattrError("user.test", syscall.ENOTSUP)
+	check(t, err == syscall.ENOTSUP, "xattrError changed %v", err)
+
+	if os.Geteuid() == 0 {
+		t.Log("running as root, which is never denied access to xattrs")
+		return
+	}
+
+	dir := tmpDir + "/TestXattrPermission"
+	err = vol.MkdirAll(dir, 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+	f, err := vol.Create(dir + "/file")
+	check(t, err == nil, "Create %q: %s", dir+"/file", err)
+	f.Close()
+
+	err = vol.Chmod(dir, 0)
+	check(t, err == nil, "Chmod %q: %s", dir, err)
+	defer vol.Chmod(dir, 0755)
+
+	_, err = vol.GetxattrValue(dir+"/file", "system.posix_acl_access")
+	check(t, errors.Is(err, ErrXattrPermission), "GetxattrValue below an inaccessible directory returned %v instead of ErrXattrPermission", err)
+}
+
+func TestACLEncoding(t *testing.T) {
+	acl := &ACL{Entries: []ACLEntry{
+		{Tag: ACLOther, Perms: 4},
+		{Tag: ACLUser, Qualifier: 1000, Perms: 6},
+		{Tag: ACLUserObj, Perms: 7},
+		{Tag: ACLMask, Perms: 6},
+		{Tag: ACLGroupObj, Perms: 5},
+	}}
+	decoded, err := decodeACL(encodeACL(acl))
+	check(t, err == nil, "decodeACL: %s", err)
+
+	expected := []ACLEntry{
+		{Tag: ACLUserObj, Qualifier: aclUndefinedID, Perms: 7},
+		{Tag: ACLUser, Qualifier: 1000, Perms: 6},
+		{Tag: ACLGroupObj, Qualifier: aclUndefinedID, Perms: 5},
+		{Tag: ACLMask, Qualifier: aclUndefinedID, Perms: 6},
+		{Tag: ACLOther, Qualifier: aclUndefinedID, Perms: 4},
+	}
+	check(t, reflect.DeepEqual(decoded.Entries, expected), "ACL round trip returned %v instead of %v", decoded.Entries, expected)
+
+	_, err = decodeACL([]byte{1, 0, 0, 0})
+	check(t, err != nil, "decodeACL accepted version 1")
+}
+
+func TestACL(t *testing.T) {
+	path := tmpDir + "/TestACL"
+	f, err := vol.CreateMode(path, 0640)
+	check(t, err == nil, "CreateMode %q: %s", path, err)
+	f.Close()
+	err = vol.Chmod(path, 0640)
+	check(t, err == nil, "Chmod %q: %s", path, err)
+
+	acl, err := vol.GetACL(path)
+	check(t, err == nil, "GetACL %q: %s", path, err)
+	check(t, len(acl.Entries) == 3, "GetACL returned %v for a file without an extended ACL", acl.Entries)
+
+	acl.Entries = append(acl.Entries,
+		ACLEntry{Tag: ACLUser, Qualifier: 4242, Perms: 6},
+		ACLEntry{Tag: ACLMask, Perms: 6})
+	err = vol.SetACL(path, acl)
+	check(t, err == nil, "SetACL %q: %s", path, err)
+
+	acl, err = vol.GetACL(path)
+	check(t, err == nil, "GetACL %q: %s", path, err)
+	found := false
+	for _, e := range acl.Entries {
+		if e.Tag == ACLUser {
+			found = true
+			check(t, e.Qualifier == 4242 && e.Perms == 6, "GetACL returned user entry %v", e)
+		}
+	}
+	check(t, found, "GetACL did not return the user entry set: %v", acl.Entries)
+}
+
+func TestRealpathLoop(t *testing.T) {
+	dir := tmpDir + "/TestRealpathLoop"
+	err := vol.MkdirAll(dir, 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+
+	vol.Unlink(dir + "/a")
+	vol.Unlink(dir + "/b")
+	err = vol.Symlink("b", dir+"/a")
+	check(t, err == nil, "Symlink %q: %s", dir+"/a", err)
+	err = vol.Symlink("a", dir+"/b")
+	check(t, err == nil, "Symlink %q: %s", dir+"/b", err)
+
+	done := make(chan error)
+	go func() {
+		_, err := vol.Realpath(dir + "/a")
+		done <- err
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(time.Minute):
+		t.Fatalf("Realpath of a symlink cycle did not return")
+	}
+	check(t, errors.Is(err, syscall.ELOOP), "Realpath of a symlink cycle returned %v instead of ELOOP", err)
+
+	_, err = vol.Stat(dir + "/a")
+	check(t, errors.Is(err, syscall.ELOOP), "Stat of a symlink cycle returned %v instead of ELOOP", err)
+}
+
+func TestSessionThread(t *testing.T) {
+	s := new(Volume).NewThreadBoundSession()
+
+	var tids []int
+	for i := 0; i < 10; i++ {
+		err := s.Do(func(*Volume) error {
+			tids = append(tids, syscall.Gettid())
+			runtime.Gosched()
+			return nil
+		})
+		check(t, err == nil, "Do: %s", err)
+	}
+	for _, tid := range tids {
+		check(t, tid == tids[0], "Session ran operations on threads %v", tids)
+	}
+
+	func() {
+		defer func() {
+			r := recover()
+			check(t, r == "boom", "Do passed on the panic %v instead of boom", r)
+		}()
+		s.Do(func(*Volume) error { panic("boom") })
+	}()
+	err := s.Do(func(*Volume) error { return nil })
+	check(t, err == nil, "Do after a panic: %s", err)
+
+	err = s.Close()
+	check(t, err == nil, "Close: %s", err)
+	err = s.Do(func(*Volume) error { return nil })
+	check(t, errors.Is(err, os.ErrClosed), "Do after Close returned %v instead of os.ErrClosed", err)
+}
+
+func TestSessionIdentity(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("setting the identity needs a privileged client")
+	}
+
+	dir := tmpDir + "/TestSessionIdentity"
+	err := vol.MkdirAll(dir, 0777)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+	err = vol.Chmod(dir, 0777)
+	check(t, err == nil, "Chmod %q: %s", dir, err)
+
+	s := vol.NewThreadBoundSession()
+	defer s.Close()
+
+	err = s.SetIdentity(4242, 4343, nil)
+	check(t, err == nil, "SetIdentity: %s", err)
+
+	names := []string{dir + "/file", dir + "/dir"}
+	err = s.Do(func(v *Volume) error {
+		f, err := v.Create(names[0])
+		if err != nil {
+			return err
+		}
+		f.Close()
+		runtime.Gosched()
+		return v.Mkdir(names[1], 0755)
+	})
+	check(t, err == nil, "Do: %s", err)
+
+	for _, name := range names {
+		fi, err := vol.Stat(name)
+		check(t, err == nil, "Stat %q: %s", name, err)
+		st := fi.Sys().(*syscall.Stat_t)
+		check(t, st.Uid == 4242 && st.Gid == 4343, "%q is owned by %d:%d instead of 4242:4343", name, st.Uid, st.Gid)
+	}
+}
+
+func TestRenameIfNotExists(t *testing.T) {
+	dir := tmpDir + "/TestRenameIfNotExists"
+	err := vol.MkdirAll(dir, 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+	for _, name := range []string{"a", "b", "c"} {
+		vol.Unlink(dir + "/" + name)
+	}
+	for _, name := range []string{"a", "b"} {
+		f, err := vol.Create(dir + "/" + name)
+		check(t, err == nil, "Create %q: %s", dir+"/"+name, err)
+		f.Close()
+	}
+
+	err = vol.RenameIfNotExists(dir+"/a", dir+"/b")
+	check(t, errors.Is(err, fs.ErrExist), "RenameIfNotExists onto an existing file returned %v instead of EEXIST", err)
+	_, err = vol.Lstat(dir + "/a")
+	check(t, err == nil, "RenameIfNotExists onto an existing file removed the source: %v", err)
+
+	err = vol.RenameIfNotExists(dir+"/a", dir+"/c")
+	check(t, err == nil, "RenameIfNotExists %q: %s", dir+"/a", err)
+	_, err = vol.Lstat(dir + "/c")
+	check(t, err == nil, "RenameIfNotExists did not create the target: %v", err)
+	_, err = vol.Lstat(dir + "/a")
+	check(t, errors.Is(err, fs.ErrNotExist), "RenameIfNotExists left the source behind: %v", err)
+}
+
+func TestIOCount(t *testing.T) {
+	n, err := ioCount(-1, syscall.EBADF, 10)
+	check(t, n == 0 && err == syscall.EBADF, "ioCount(-1, EBADF) returned %d, %v", n, err)
+
+	n, err = ioCount(-1, nil, 10)
+	check(t, n == 0 && err == syscall.EIO, "ioCount(-1, nil) returned %d, %v", n, err)
+
+	n, err = ioCount(11, nil, 10)
+	check(t, n == 0 && errors.Is(err, syscall.EIO), "ioCount of more than requested returned %d, %v", n, err)
+
+	n, err = ioCount(int64(math.MaxInt32)+1, nil, math.MaxInt32)
+	check(t, n == 0 && err != nil, "ioCount beyond a 32 bit int returned %d, %v", n, err)
+
+	n, err = ioCount(7, syscall.EINTR, 10)
+	check(t, n == 7 && err == nil, "ioCount(7) with a stale errno returned %d, %v", n, err)
+}
+
+func TestMkdirIfNotExists(t *testing.T) {
+	dir := tmpDir + "/TestMkdirIfNotExists"
+	vol.Rmdir(dir)
+
+	created, err := vol.MkdirIfNotExists(dir, 0755)
+	check(t, err == nil && created, "MkdirIfNotExists %q: %v, %v", dir, created, err)
+
+	created, err = vol.MkdirIfNotExists(dir, 0755)
+	check(t, err == nil && !created, "MkdirIfNotExists of an existing %q: %v, %v", dir, created, err)
+
+	err = vol.Mkdir(dir, 0755)
+	check(t, errors.Is(err, fs.ErrExist), "Mkdir of an existing %q returned %v, which is not fs.ErrExist", dir, err)
+
+	file := dir + "/file"
+	f, err := vol.Create(file)
+	check(t, err == nil, "Create %q: %s", file, err)
+	f.Close()
+	created, err = vol.MkdirIfNotExists(file, 0755)
+	check(t, errors.Is(err, fs.ErrExist) && !created, "MkdirIfNotExists over file %q: %v, %v", file, created, err)
+}
+
+func TestWriteSparse(t *testing.T) {
+	name := tmpDir + "/TestWriteSparse"
+	filled := bytes.Repeat([]byte{0xaa}, 1<<20)
+	content := append(append(append([]byte{}, filled...), make([]byte, 8<<20)...), filled...)
+
+	if err := vol.WriteSparse(name, bytes.NewReader(content), 64<<10); err != nil {
+		t.Fatalf("WriteSparse failed: %v", err)
+	}
+	defer vol.Unlink(name)
+
+	got, err := vol.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("content of %s differs from the written content", name)
+	}
+
+	f, err := vol.Open(name)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	hole, err := f.Seek(0, SEEK_HOLE)
+	if errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.ENXIO) {
+		t.Skipf("SEEK_HOLE not supported: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("Seek SEEK_HOLE failed: %v", err)
+	}
+	if hole >= int64(len(content)) {
+		t.Errorf("no hole found in %s, SEEK_HOLE returned %d", name, hole)
+	}
+}
+
+func TestOpenFileInvalidFlags(t *testing.T) {
+	path := tmpDir + "/TestOpenFileInvalidFlags"
+	for _, flags := range []int{
+		os.O_RDONLY | os.O_TRUNC,
+		os.O_RDONLY | os.O_APPEND,
+		os.O_WRONLY | os.O_RDWR,
+	} {
+		f, err := vol.OpenFile(path, flags|os.O_CREATE, 0644)
+		if err == nil {
+			f.Close()
+			t.Errorf("OpenFile with flags %#o succeeded", flags)
+			continue
+		}
+		if !errors.Is(err, ErrInvalidFlags) {
+			t.Errorf("OpenFile with flags %#o: expected ErrInvalidFlags, got %v", flags, err)
+		}
+	}
+	if _, err := vol.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("OpenFile with invalid flags created the file: %v", err)
+	}
+}
+
+func TestOpenFlagsChmod(t *testing.T) {
+	for _, flag := range []int{
+		os.O_WRONLY, os.O_RDWR, os.O_APPEND, os.O_CREATE, os.O_EXCL, os.O_SYNC, os.O_TRUNC,
+		syscall.O_DIRECTORY, syscall.O_NOFOLLOW, syscall.O_CLOEXEC, syscall.O_NONBLOCK,
+		syscall.O_NOATIME, syscall.O_DIRECT, syscall.O_DSYNC, O_TMPFILE, O_PATH,
+	} {
+		check(t, flag&O_CHMOD == 0, "O_CHMOD %#o overlaps the open flag %#o", O_CHMOD, flag)
+	}
+
+	for _, flags := range []int{
+		os.O_RDONLY | syscall.O_DIRECTORY | O_CHMOD,
+		O_PATH | O_CHMOD,
+	} {
+		err := checkOpenFlags(flags)
+		check(t, errors.Is(err, ErrInvalidFlags), "checkOpenFlags(%#o) returned %v instead of ErrInvalidFlags", flags, err)
+	}
+	for _, flags := range []int{
+		os.O_RDWR | O_CHMOD,
+		os.O_WRONLY | O_TMPFILE | O_CHMOD,
+	} {
+		err := checkOpenFlags(flags)
+		check(t, err == nil, "checkOpenFlags(%#o): %s", flags, err)
+	}
+
+	_, err := new(File).Openat("name", os.O_RDWR|O_CHMOD, 0600)
+	check(t, errors.Is(err, ErrInvalidFlags), "Openat with O_CHMOD returned %v instead of ErrInvalidFlags", err)
+}
+
+func TestOpenSection(t *testing.T) {
+	path := tmpDir + "/TestOpenSection"
+	content := make([]byte, 1000)
+	for i := range content {
+		content[i] = byte(i)
+	}
+
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	_, err = f.Write(content)
+	check(t, err == nil, "Write %q: %s", path, err)
+	f.Close()
+	defer vol.Unlink(path)
+
+	sr, err := vol.OpenSection(path, 100, 100)
+	check(t, err == nil, "OpenSection %q: %s", path, err)
+	got, err := io.ReadAll(sr)
+	check(t, err == nil && bytes.Equal(got, content[100:200]), "Read section [100,200) of %q: %v, %v", path, got, err)
+	err = sr.Close()
+	check(t, err == nil, "Close section of %q: %s", path, err)
+
+	sr, err = vol.OpenSection(path, 900, 500)
+	check(t, err == nil, "OpenSection past EOF %q: %s", path, err)
+	check(t, sr.Size() == 100, "OpenSection past EOF %q: size %d", path, sr.Size())
+	sr.Close()
+
+	sr, err = vol.OpenSection(path, 2000, 10)
+	check(t, err == nil, "OpenSection beyond EOF %q: %s", path, err)
+	check(t, sr.Size() == 0, "OpenSection beyond EOF %q: size %d", path, sr.Size())
+	sr.Close()
+
+	_, err = vol.OpenSection(path, -1, 10)
+	check(t, errors.Is(err, ErrNegativeOffset), "OpenSection negative offset %q: %v", path, err)
+}
+
+func TestTmpfileMaterialize(t *testing.T) {
+	dir := tmpDir + "/TestTmpfileMaterialize"
+	err := vol.MkdirAll(dir, 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+	name := dir + "/file"
+	vol.Unlink(name)
+
+	f, err := vol.OpenFile(dir, O_TMPFILE|os.O_RDWR, 0640)
+	if errors.Is(err, syscall.ENOTSUP) {
+		t.Skipf("O_TMPFILE not supported: %s", err)
+	}
+	check(t, err == nil, "OpenFile O_TMPFILE %q: %s", dir, err)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	check(t, err == nil, "Write O_TMPFILE %q: %s", dir, err)
+
+	names, err := vol.ReadDirNames(dir)
+	check(t, err == nil && len(names) == 0, "ReadDirNames %q before Materialize: %v, %v", dir, names, err)
+
+	err = f.Materialize(name)
+	if errors.Is(err, syscall.ENOTSUP) {
+		t.Skipf("linking O_TMPFILE not supported: %s", err)
+	}
+	check(t, err == nil, "Materialize %q: %s", name, err)
+	defer vol.Unlink(name)
+	check(t, f.Name() == name, "Materialize %q: file named %q", name, f.Name())
+
+	got, err := vol.ReadFile(name)
+	check(t, err == nil, "ReadFile %q: %s", name, err)
+	check(t, bytes.Equal(got, data), "ReadFile %q: %q != %q", name, got, data)
+
+	info, err := vol.Stat(name)
+	check(t, err == nil, "Stat %q: %s", name, err)
+	check(t, info.Mode().Perm() == 0640, "Stat %q: mode %v != %v", name, info.Mode().Perm(), os.FileMode(0640))
+
+	_, err = vol.OpenFile(dir, O_TMPFILE|os.O_RDONLY, 0640)
+	check(t, errors.Is(err, ErrInvalidFlags), "OpenFile O_TMPFILE|O_RDONLY %q: %v", dir, err)
+}
+
+func TestCloseError(t *testing.T) {
+	defer func(close func(*File) error) { closeFile = close }(closeFile)
+	closeFile = func(*File) error { return syscall.EIO }
+
+	err := NewFile("/TestCloseError", &Glfs{}, false).Close()
+	var perr *os.PathError
+	check(t, errors.As(err, &perr), "Close returned %T instead of *os.PathError", err)
+	check(t, perr.Op == "close" && perr.Path == "/TestCloseError", "Close: op %q, path %q", perr.Op, perr.Path)
+	check(t, errors.Is(err, syscall.EIO), "Close: %v doesn't wrap EIO", err)
+}
+
+func TestLstatModeType(t *testing.T) {
+	dir := tmpDir + "/TestLstatModeType"
+	err := vol.MkdirAll(dir+"/dir", 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir+"/dir", err)
+
+	vol.Unlink(dir + "/link")
+	err = vol.Symlink("dir", dir+"/link")
+	check(t, err == nil, "Symlink %q: %s", dir+"/link", err)
+	defer vol.Unlink(dir + "/link")
+
+	vol.Unlink(dir + "/fifo")
+	err = vol.Mknod(dir+"/fifo", syscall.S_IFIFO|0644, 0)
+	check(t, err == nil, "Mknod %q: %s", dir+"/fifo", err)
+	defer vol.Unlink(dir + "/fifo")
+
+	for name, typ := range map[string]os.FileMode{
+		"dir":  os.ModeDir,
+		"link": os.ModeSymlink,
+		"fifo": os.ModeNamedPipe,
+	} {
+		fi, err := vol.Lstat(dir + "/" + name)
+		check(t, err == nil, "Lstat %q: %s", dir+"/"+name, err)
+		check(t, fi.Mode().Type() == typ, "Lstat %q: type %v != %v", dir+"/"+name, fi.Mode().Type(), typ)
+	}
+}
+
+func TestCloseOnExec(t *testing.T) {
+	path := tmpDir + "/TestCloseOnExec"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+
+	check(t, f.CloseOnExec(), "CloseOnExec %q returned false", path)
+	err = f.SetCloseOnExec(true)
+	check(t, err == nil, "SetCloseOnExec(true) %q: %s", path, err)
+	err = f.SetCloseOnExec(false)
+	check(t, errors.Is(err, syscall.ENOTSUP), "SetCloseOnExec(false) %q returned %v instead of ENOTSUP", path, err)
+	check(t, f.CloseOnExec(), "CloseOnExec %q returned false after SetCloseOnExec(false)", path)
+
+	f.Close()
+	err = f.SetCloseOnExec(true)
+	check(t, errors.Is(err, os.ErrClosed), "SetCloseOnExec on a closed file %q returned %v", path, err)
+}
+
+func TestOpenVolume(t *testing.T) {
+	v, err := OpenVolume("test", "localhost")
+	check(t, err == nil, "OpenVolume: %s", err)
+	defer v.Unmount()
+
+	fi, err := v.Stat("/")
+	check(t, err == nil, "Stat %q: %s", "/", err)
+	check(t, fi.IsDir(), "Stat %q: not a directory", "/")
+}
+
+func TestUnmountTwice(t *testing.T) {
+	v, err := OpenVolume("test", "localhost")
+	check(t, err == nil, "OpenVolume: %s", err)
+
+	err = v.Unmount()
+	check(t, err == nil, "Unmount: %s", err)
+	err = v.Unmount()
+	check(t, err == nil, "second Unmount: %s", err)
+}
+
+func TestDiffWatchEntries(t *testing.T) {
+	mtime := time.Unix(1000, 0)
+	old := map[string]watchEntry{
+		"/d/kept":     {ino: 1, size: 1, mtime: mtime},
+		"/d/written":  {ino: 2, size: 1, mtime: mtime},
+		"/d/removed":  {ino: 3, size: 1, mtime: mtime},
+		"/d/replaced": {ino: 4, size: 1, mtime: mtime},
+	}
+	cur := map[string]watchEntry{
+		"/d/kept":     {ino: 1, size: 1, mtime: mtime},
+		"/d/written":  {ino: 2, size: 2, mtime: mtime.Add(time.Second)},
+		"/d/replaced": {ino: 5, size: 1, mtime: mtime},
+		"/d/created":  {ino: 6, size: 0, mtime: mtime},
+	}
+
+	events := diffWatchEntries(old, cur)
+	want := []Event{
+		{Name: "/d/created", Op: EventCreate},
+		{Name: "/d/removed", Op: EventDelete},
+		{Name: "/d/replaced", Op: EventDelete},
+		{Name: "/d/replaced", Op: EventCreate},
+		{Name: "/d/written", Op: EventModify},
+	}
+	check(t, reflect.DeepEqual(events, want), "diffWatchEntries: got %v, want %v", events, want)
+}
+
+func TestWatch(t *testing.T) {
+	if !Supports(FeatureUpcall) {
+		t.Skip("libgfapi lacks upcalls")
+	}
+
+	dir := tmpDir + "/TestWatch"
+	err := vol.MkdirAll(dir, 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+
+	events, stop, err := vol.Watch(dir)
+	check(t, err == nil, "Watch %q: %s", dir, err)
+	defer stop()
+
+	// gluster sends no upcalls to the client making the change, so the
+	// file is created through a second client
+	other, err := OpenVolume("test", "localhost")
+	check(t, err == nil, "OpenVolume: %s", err)
+	defer other.Unmount()
+
+	name := dir + "/file"
+	f, err := other.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	f.Close()
+	defer vol.Unlink(name)
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case ev, ok := <-events:
+			check(t, ok, "Watch %q: channel closed", dir)
+			if ev.Name == name && ev.Op == EventCreate {
+				return
+			}
+		case <-timeout:
+			t.Skip("no event received, features.cache-invalidation is probably disabled on the volume")
+		}
+	}
+}
+
+func TestOpenRetryStale(t *testing.T) {
+	defer func(open func(*Volume, string) (*File, error)) { openFile = open }(openFile)
+
+	calls, fails := 0, 1
+	openFile = func(v *Volume, name string) (*File, error) {
+		calls++
+		if fails > 0 {
+			fails--
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.ESTALE}
+		}
+		return NewFile(name, &Glfs{}, false), nil
+	}
+
+	v := &Volume{mounted: true}
+	_, err := v.Open("/TestOpenRetryStale")
+	check(t, errors.Is(err, syscall.ESTALE), "Open without retry: %v", err)
+	check(t, calls == 1, "Open without retry made %d attempts instead of 1", calls)
+
+	calls, fails = 0, 1
+	v.SetRetryStale(true)
+	f, err := v.Open("/TestOpenRetryStale")
+	check(t, err == nil, "Open with retry: %s", err)
+	check(t, f.Name() == "/TestOpenRetryStale", "Open with retry: got %q", f.Name())
+	check(t, calls == 2, "Open with retry made %d attempts instead of 2", calls)
+
+	// Only a single retry is made
+	calls, fails = 0, 3
+	_, err = v.Open("/TestOpenRetryStale")
+	check(t, errors.Is(err, syscall.ESTALE), "Open with retry: %v", err)
+	check(t, calls == 2, "Open with retry made %d attempts instead of 2", calls)
+}
+
+func TestOpenPath(t *testing.T) {
+	if !Supports(FeatureOpenat) {
+		t.Skip("libgfapi lacks the *at calls")
+	}
+
+	dir := tmpDir + "/TestOpenPath"
+	err := vol.MkdirAll(dir, 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+
+	name := dir + "/file"
+	f, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	f.Close()
+	defer vol.Unlink(name)
+
+	d, err := vol.OpenFile(dir, O_PATH|syscall.O_DIRECTORY, 0)
+	check(t, err == nil, "OpenFile %q with O_PATH: %s", dir, err)
+	defer d.Close()
+
+	fi, err := d.Statat("file", 0)
+	check(t, err == nil, "Statat %q: %s", "file", err)
+	check(t, fi.Mode().IsRegular(), "Statat %q: mode %v", "file", fi.Mode())
+
+	_, err = d.Read(make([]byte, 1))
+	check(t, errors.Is(err, syscall.EBADF), "Read on O_PATH handle: %v", err)
+	_, err = d.Write([]byte("x"))
+	check(t, errors.Is(err, syscall.EBADF), "Write on O_PATH handle: %v", err)
+
+	_, err = vol.OpenFile(name, O_PATH|syscall.O_DIRECTORY, 0)
+	check(t, errors.Is(err, syscall.ENOTDIR), "OpenFile %q with O_PATH|O_DIRECTORY: %v", name, err)
+	_, err = vol.OpenFile(name, O_PATH|os.O_RDWR, 0)
+	check(t, errors.Is(err, ErrInvalidFlags), "OpenFile %q with O_PATH|O_RDWR: %v", name, err)
+}
+
+func TestPosixMode(t *testing.T) {
+	specials := []struct {
+		mode os.FileMode
+		bits uint32
+	}{
+		{0, 0},
+		{os.ModeSetuid, syscall.S_ISUID},
+		{os.ModeSetgid, syscall.S_ISGID},
+		{os.ModeSticky, syscall.S_ISVTX},
+		{os.ModeSetuid | os.ModeSetgid | os.ModeSticky, syscall.S_ISUID | syscall.S_ISGID | syscall.S_ISVTX},
+	}
+	for perm := os.FileMode(0); perm <= 0777; perm++ {
+		for _, sp := range specials {
+			want := uint32(perm) | sp.bits
+			got := posixMode(perm | sp.mode)
+			check(t, got == want, "posixMode(%v) = %#o instead of %#o", perm|sp.mode, got, want)
+
+			// The file type bits are not part of the mode chmod takes
+			got = posixMode(os.ModeDir | perm | sp.mode)
+			check(t, got == want, "posixMode(%v) = %#o instead of %#o", os.ModeDir|perm|sp.mode, got, want)
+
+			st := syscall.Stat_t{Mode: syscall.S_IFDIR | want}
+			mode := fileInfoFromStat(&st, "dir").Mode()
+			check(t, mode == os.ModeDir|perm|sp.mode, "fileInfoFromStat(%#o) mode %v instead of %v", st.Mode, mode, os.ModeDir|perm|sp.mode)
+		}
+	}
+}
+
+func TestChmodSpecialBits(t *testing.T) {
+	dir := tmpDir + "/TestChmodSpecialBits"
+	err := vol.MkdirAll(dir, 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+
+	name := dir + "/file"
+	f, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	f.Close()
+	defer vol.Unlink(name)
+
+	for _, tc := range []struct {
+		name string
+		mode os.FileMode
+	}{
+		// setgid on a directory makes new entries inherit its group
+		{dir, os.ModeSetgid | 0775},
+		{dir, os.ModeSticky | 0777},
+		{dir, 0750},
+		{name, os.ModeSetuid | 0755},
+		{name, os.ModeSetgid | 0750},
+		{name, 0640},
+	} {
+		err := vol.Chmod(tc.name, tc.mode)
+		check(t, err == nil, "Chmod %q %v: %s", tc.name, tc.mode, err)
+		fi, err := vol.Stat(tc.name)
+		check(t, err == nil, "Stat %q: %s", tc.name, err)
+		got := fi.Mode() &^ os.ModeType
+		check(t, got == tc.mode, "Chmod %q %v set mode %v", tc.name, tc.mode, got)
+	}
+}
+
+func TestCopyTo(t *testing.T) {
+	name := tmpDir + "/TestCopyTo"
+	data := bytes.Repeat([]byte("0123456789abcdef"), 20000)
+
+	f, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", name, err)
+	f.Close()
+	defer vol.Unlink(name)
+
+	var buf bytes.Buffer
+	n, err := vol.CopyTo(&buf, name)
+	check(t, err == nil, "CopyTo %q: %s", name, err)
+	check(t, n == int64(len(data)), "CopyTo %q copied %d bytes instead of %d", name, n, len(data))
+	check(t, bytes.Equal(buf.Bytes(), data), "CopyTo %q: content differs", name)
+
+	_, err = vol.CopyTo(&buf, name+".missing")
+	check(t, errors.Is(err, fs.ErrNotExist), "CopyTo missing file: %v", err)
+}
+
+func TestCopyFrom(t *testing.T) {
+	name := tmpDir + "/TestCopyFrom"
+	data := make([]byte, 3<<20+123)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	defer vol.Unlink(name)
+
+	n, err := vol.CopyFrom(name, bytes.NewReader(data), 0640)
+	check(t, err == nil, "CopyFrom %q: %s", name, err)
+	check(t, n == int64(len(data)), "CopyFrom %q wrote %d bytes instead of %d", name, n, len(data))
+
+	var buf bytes.Buffer
+	_, err = vol.CopyTo(&buf, name)
+	check(t, err == nil, "CopyTo %q: %s", name, err)
+	check(t, bytes.Equal(buf.Bytes(), data), "CopyFrom %q: stored content differs", name)
+
+	// A failing reader surfaces its error after the data read before it
+	readErr := errors.New("reader failed")
+	n, err = vol.CopyFrom(name, io.MultiReader(bytes.NewReader(data[:1000]), iotest.ErrReader(readErr)), 0640)
+	check(t, errors.Is(err, readErr), "CopyFrom with failing reader: %v", err)
+	check(t, n == 1000, "CopyFrom with failing reader wrote %d bytes instead of 1000", n)
+}
+
+func TestListUserXattrs(t *testing.T) {
+	name := tmpDir + "/TestListUserXattrs"
+	f, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	f.Close()
+	defer vol.Unlink(name)
+
+	for _, attr := range []string{"user.b", "user.a"} {
+		err := vol.Setxattr(name, attr, []byte("value"), 0)
+		check(t, err == nil, "Setxattr %q %q: %s", name, attr, err)
+	}
+	// Setting trusted.* attributes requires CAP_SYS_ADMIN
+	trusted := vol.Setxattr(name, "trusted.test", []byte("value"), 0) == nil
+
+	names, err := vol.ListUserXattrs(name)
+	check(t, err == nil, "ListUserXattrs %q: %s", name, err)
+	check(t, reflect.DeepEqual(names, []string{"user.a", "user.b"}), "ListUserXattrs %q: %q", name, names)
+
+	names, err = vol.ListUserXattrs(name, "trusted")
+	check(t, err == nil, "ListUserXattrs %q with trusted: %s", name, err)
+	check(t, !trusted || slices.Contains(names, "trusted.test"), "ListUserXattrs %q with trusted: %q lacks trusted.test", name, names)
+	for _, attr := range names {
+		check(t, strings.HasPrefix(attr, "user.") || strings.HasPrefix(attr, "trusted."), "ListUserXattrs %q with trusted: unexpected %q", name, attr)
+	}
+}
+
+func TestOpenDirNotDir(t *testing.T) {
+	dir := tmpDir + "/TestOpenDirNotDir"
+	err := vol.MkdirAll(dir, 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir, err)
+
+	name := dir + "/file"
+	f, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	f.Close()
+	defer vol.Unlink(name)
+
+	_, err = vol.OpenDir(name)
+	check(t, errors.Is(err, syscall.ENOTDIR), "OpenDir %q: %v", name, err)
+	_, err = vol.OpenFile(name, os.O_RDONLY|syscall.O_DIRECTORY, 0)
+	check(t, errors.Is(err, syscall.ENOTDIR), "OpenFile %q with O_DIRECTORY: %v", name, err)
+	_, err = vol.OpenFile(dir, os.O_RDWR|syscall.O_DIRECTORY, 0)
+	check(t, errors.Is(err, syscall.EISDIR), "OpenFile %q with O_RDWR|O_DIRECTORY: %v", dir, err)
+
+	d, err := vol.OpenFile(dir, os.O_RDONLY|syscall.O_DIRECTORY, 0)
+	check(t, err == nil, "OpenFile %q with O_DIRECTORY: %s", dir, err)
+	defer d.Close()
+	names, err := d.Readdirnames(0)
+	check(t, err == nil, "Readdirnames %q: %s", dir, err)
+	check(t, slices.Contains(names, "file"), "Readdirnames %q: %q lacks %q", dir, names, "file")
+}
+
+func TestIOBufferSize(t *testing.T) {
+	v := new(Volume)
+	check(t, v.ioBuffers() == buffers, "Volume without SetIOBufferSize doesn't use the package buffers")
+
+	v.SetIOBufferSize(1 << 20)
+	buf := v.ioBuffers().get()
+	check(t, len(*buf) == 1<<20, "ioBuffers returned %d bytes instead of %d", len(*buf), 1<<20)
+	v.ioBuffers().put(buf)
+
+	v.SetIOBufferSize(1)
+	buf = v.ioBuffers().get()
+	check(t, len(*buf) == minBufferSize, "ioBuffers returned %d bytes instead of the minimum %d", len(*buf), minBufferSize)
+
+	v.SetIOBufferSize(0)
+	check(t, v.ioBuffers() == buffers, "SetIOBufferSize(0) doesn't go back to the package buffers")
+}
+
+func TestCopyWithIOBufferSize(t *testing.T) {
+	defer vol.SetIOBufferSize(0)
+	vol.SetIOBufferSize(5000)
+
+	name := tmpDir + "/TestCopyWithIOBufferSize"
+	data := make([]byte, 4<<20+17)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	defer vol.Unlink(name)
+
+	n, err := vol.CopyFrom(name, bytes.NewReader(data), 0644)
+	check(t, err == nil, "CopyFrom %q: %s", name, err)
+	check(t, n == int64(len(data)), "CopyFrom %q wrote %d bytes instead of %d", name, n, len(data))
+
+	var buf bytes.Buffer
+	n, err = vol.CopyTo(&buf, name)
+	check(t, err == nil, "CopyTo %q: %s", name, err)
+	check(t, n == int64(len(data)), "CopyTo %q copied %d bytes instead of %d", name, n, len(data))
+	check(t, bytes.Equal(buf.Bytes(), data), "copy through %d byte buffers differs", 5000)
+}
+
+func TestWriteStringAt(t *testing.T) {
+	name := tmpDir + "/TestWriteStringAt"
+	f, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	defer f.Close()
+	defer vol.Unlink(name)
+
+	_, err = f.WriteString("hello, world")
+	check(t, err == nil, "WriteString %q: %s", name, err)
+	n, err := f.WriteStringAt("WORLD", 7)
+	check(t, err == nil && n == 5, "WriteStringAt %q: wrote %d bytes, %v", name, n, err)
+
+	buf := make([]byte, 12)
+	_, err = f.ReadAt(buf, 0)
+	check(t, err == nil, "ReadAt %q: %s", name, err)
+	check(t, string(buf) == "hello, WORLD", "ReadAt %q read %q", name, buf)
+}
+
+func TestMoveCopyFallback(t *testing.T) {
+	defer func(rename func(*Volume, string, string) error) { moveRename = rename }(moveRename)
+	moveRename = func(*Volume, string, string) error { return syscall.EXDEV }
+
+	dir := tmpDir + "/TestMoveCopyFallback"
+	err := vol.MkdirAll(dir+"/dir", 0755)
+	check(t, err == nil, "MkdirAll %q: %s", dir+"/dir", err)
+
+	src, dst := dir+"/src", dir+"/dst"
+	data := bytes.Repeat([]byte("moved by copying\n"), 10000)
+	_, err = vol.CopyFrom(src, bytes.NewReader(data), 0600)
+	check(t, err == nil, "CopyFrom %q: %s", src, err)
+	defer vol.Unlink(src)
+	defer vol.Unlink(dst)
+
+	err = vol.Setxattr(src, "user.test", []byte("value"), 0)
+	check(t, err == nil, "Setxattr %q: %s", src, err)
+	err = vol.Chmod(src, os.ModeSetgid|0640)
+	check(t, err == nil, "Chmod %q: %s", src, err)
+	mtime := time.Unix(1500000000, 123456789)
+	err = vol.Chtimes(src, mtime)
+	check(t, err == nil, "Chtimes %q: %s", src, err)
+
+	err = vol.Move(src, dst)
+	check(t, err == nil, "Move %q: %s", src, err)
+
+	_, err = vol.Lstat(src)
+	check(t, errors.Is(err, fs.ErrNotExist), "Lstat %q after Move: %v", src, err)
+
+	var buf bytes.Buffer
+	_, err = vol.CopyTo(&buf, dst)
+	check(t, err == nil, "CopyTo %q: %s", dst, err)
+	check(t, bytes.Equal(buf.Bytes(), data), "Move %q: content differs", dst)
+
+	value, err := vol.GetxattrValue(dst, "user.test")
+	check(t, err == nil, "GetxattrValue %q: %s", dst, err)
+	check(t, string(value) == "value", "GetxattrValue %q: %q", dst, value)
+
+	fi, err := vol.Stat(dst)
+	check(t, err == nil, "Stat %q: %s", dst, err)
+	check(t, fi.Mode() == os.ModeSetgid|0640, "Move %q: mode %v", dst, fi.Mode())
+	check(t, fi.ModTime().Equal(mtime), "Move %q: mtime %v instead of %v", dst, fi.ModTime(), mtime)
+
+	// Directories are not moved by copying
+	err = vol.Move(dir+"/dir", dir+"/dir2")
+	check(t, errors.Is(err, syscall.EXDEV), "Move %q: %v", dir+"/dir", err)
+}
+
+func TestWatchCloseAll(t *testing.T) {
+	v := new(Volume)
+	w := &watcher{
+		v:      v,
+		path:   "/TestWatchCloseAll",
+		wake:   make(chan struct{}, 1),
+		events: make(chan Event, 64),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	v.watch.watchers = map[*watcher]struct{}{w: {}}
+	go w.run()
+
+	v.watch.closeAll()
+	select {
+	case <-w.done:
+	default:
+		t.Fatalf("closeAll returned before the watcher goroutine")
+	}
+	_, ok := <-w.events
+	check(t, !ok, "events channel not closed by closeAll")
+}
+
 func TestUnmount(t *testing.T) {
 	if err := vol.Unmount(); err != nil {
 		t.Logf("Failed to unmount volume. Ret = %v", err)
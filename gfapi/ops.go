@@ -0,0 +1,65 @@
+package gfapi
+
+// This file includes the tracking of operations that run in the background
+// of a Volume, so that Unmount does not free the glfs object under them
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultUnmountTimeout is how long Unmount waits for background operations.
+const defaultUnmountTimeout = 30 * time.Second
+
+// opTracker counts the operations in flight on a Volume. Its zero value has
+// no operations in flight.
+type opTracker struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{} // closed once n drops back to 0
+}
+
+// begin registers an operation, which must be ended with end.
+func (t *opTracker) begin() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.n == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.n++
+}
+
+// end unregisters an operation registered with begin.
+func (t *opTracker) end() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.n--
+	if t.n == 0 {
+		close(t.idle)
+	}
+}
+
+// wait waits up to timeout for all operations to end, and returns the number
+// still in flight.
+func (t *opTracker) wait(timeout time.Duration) int {
+	t.mu.Lock()
+	idle := t.idle
+	n := t.n
+	t.mu.Unlock()
+	if n == 0 {
+		return 0
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-idle:
+	case <-timer.C:
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.n
+}
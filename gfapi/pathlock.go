@@ -0,0 +1,68 @@
+package gfapi
+
+// This file includes the in-process locking of paths on a Volume
+
+import (
+	"path"
+	"sync"
+)
+
+// pathLock is a mutex in a pathLocks registry, with the number of goroutines
+// holding or waiting for it.
+type pathLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// pathLocks is a registry of mutexes keyed by cleaned path. Its zero value
+// is ready to use.
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+// lock locks the mutex of name, and returns the function unlocking it.
+// Mutexes are dropped from the registry once no one holds or waits for them.
+func (r *pathLocks) lock(name string) func() {
+	key := path.Clean(name)
+
+	r.mu.Lock()
+	if r.locks == nil {
+		r.locks = make(map[string]*pathLock)
+	}
+	l := r.locks[key]
+	if l == nil {
+		l = new(pathLock)
+		r.locks[key] = l
+	}
+	l.refs++
+	r.mu.Unlock()
+
+	l.mu.Lock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Unlock()
+
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			l.refs--
+			if l.refs == 0 {
+				delete(r.locks, key)
+			}
+		})
+	}
+}
+
+// LockPath locks name for the calling goroutine, waiting until no other
+// goroutine holds the lock, and returns the function releasing it. Names are
+// cleaned first, so "a/b" and "a//b/" share a lock, but different names for
+// the same file, through links or relative names, do not.
+//
+// The lock is advisory and only serializes goroutines of this process that
+// use LockPath on the Volume. It is much cheaper than, and can be combined
+// with, POSIX locks, which are needed to coordinate with other clients.
+func (v *Volume) LockPath(name string) (unlock func()) {
+	return v.pathLocks.lock(name)
+}
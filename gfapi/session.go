@@ -0,0 +1,126 @@
+package gfapi
+
+// This file includes sessions running Volume operations on a single OS thread
+
+// #cgo pkg-config: glusterfs-api
+// #include "glusterfs/api/glfs.h"
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// Session runs operations on a Volume on an OS thread of its own, so that
+// they all see the per-thread state gfapi keeps, most notably the identity
+// set with SetIdentity, which would otherwise apply to whichever goroutine
+// happens to run on the thread next.
+type Session struct {
+	v    *Volume
+	ops  chan func()
+	once sync.Once
+	done chan struct{}
+}
+
+// NewThreadBoundSession starts a Session on the Volume v, locking an OS
+// thread for it until it is closed.
+func (v *Volume) NewThreadBoundSession() *Session {
+	s := &Session{
+		v:    v,
+		ops:  make(chan func()),
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		// The thread is never unlocked, so that it exits along with the
+		// goroutine, taking the identity and other state set on it along
+		// instead of handing it to other goroutines.
+		runtime.LockOSThread()
+		for {
+			select {
+			case op := <-s.ops:
+				op()
+			case <-s.done:
+				return
+			}
+		}
+	}()
+
+	return s
+}
+
+// Do runs fn with the Session's Volume on the Session's thread, and returns
+// the error fn returns. Calls from several goroutines are run one at a time.
+// If fn panics, the panic is passed on to the caller of Do, and the Session
+// remains usable.
+//
+// Returns an error wrapping os.ErrClosed if the Session is closed
+func (s *Session) Do(fn func(v *Volume) error) error {
+	type outcome struct {
+		err   error
+		panic any
+	}
+
+	result := make(chan outcome, 1)
+	op := func() {
+		// A panic on the Session's thread would crash the program, so it is
+		// recovered there and raised again in the caller.
+		defer func() {
+			if r := recover(); r != nil {
+				result <- outcome{panic: r}
+			}
+		}()
+		result <- outcome{err: fn(s.v)}
+	}
+
+	select {
+	case s.ops <- op:
+		r := <-result
+		if r.panic != nil {
+			panic(r.panic)
+		}
+		return r.err
+	case <-s.done:
+		return fmt.Errorf("session: %w", os.ErrClosed)
+	}
+}
+
+// SetIdentity sets the uid, gid and supplementary groups the operations run
+// through the Session are performed as, which needs the client to be
+// privileged. A nil groups clears the supplementary groups.
+//
+// Returns an error on failure
+func (s *Session) SetIdentity(uid, gid int, groups []int) error {
+	return s.Do(func(*Volume) error {
+		if ret, err := C.glfs_setfsuid(C.uid_t(uid)); ret < 0 {
+			return fmt.Errorf("setfsuid %d: %w", uid, err)
+		}
+		if ret, err := C.glfs_setfsgid(C.gid_t(gid)); ret < 0 {
+			return fmt.Errorf("setfsgid %d: %w", gid, err)
+		}
+
+		list := make([]C.gid_t, len(groups))
+		for i, g := range groups {
+			list[i] = C.gid_t(g)
+		}
+		var clist *C.gid_t
+		if len(list) > 0 {
+			clist = &list[0]
+		}
+		if ret, err := C.glfs_setfsgroups(C.size_t(len(list)), clist); ret < 0 {
+			return fmt.Errorf("setfsgroups %v: %w", groups, err)
+		}
+		return nil
+	})
+}
+
+// Close ends the Session, releasing its thread. The thread is terminated
+// rather than handed back to the Go scheduler, so that the identity set on it
+// cannot leak to other goroutines. Close waits for no running operation, and
+// can be called more than once.
+func (s *Session) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
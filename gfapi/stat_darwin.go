@@ -8,3 +8,8 @@ import (
 func getLastModification(st *syscall.Stat_t) syscall.Timespec {
 	return st.Mtimespec
 }
+
+// getLastAccess returns the access time
+func getLastAccess(st *syscall.Stat_t) syscall.Timespec {
+	return st.Atimespec
+}
@@ -0,0 +1,147 @@
+package gfapi
+
+// This file includes the optional cache of Volume.Stat results
+
+import (
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statter performs an uncached stat of a path.
+type statter interface {
+	stat(name string) (os.FileInfo, error)
+}
+
+type statCacheEntry struct {
+	info    os.FileInfo
+	expires time.Time
+}
+
+// statCache caches successful stats of paths for a fixed duration.
+type statCache struct {
+	src statter
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]statCacheEntry
+	lastSweep time.Time
+}
+
+func newStatCache(src statter, ttl time.Duration) *statCache {
+	return &statCache{
+		src:       src,
+		ttl:       ttl,
+		entries:   make(map[string]statCacheEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// stat returns the cached os.FileInfo for name if it has not expired yet, and
+// otherwise stats name through the source and caches the result.
+func (c *statCache) stat(name string) (os.FileInfo, error) {
+	key := path.Clean(name)
+	now := time.Now()
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.info, nil
+	}
+
+	info, err := c.src.stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[key] = statCacheEntry{info: info, expires: now.Add(c.ttl)}
+	if now.Sub(c.lastSweep) > c.ttl {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+	c.mu.Unlock()
+
+	return info, nil
+}
+
+// invalidate drops the entry for name and, if children is set, the entries
+// for everything below name in case it is a directory.
+func (c *statCache) invalidate(name string, children bool) {
+	key := path.Clean(name)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+	if !children {
+		return
+	}
+
+	prefix := key + "/"
+	if key == "/" {
+		prefix = key
+	}
+	for k := range c.entries {
+		if strings.HasPrefix(k, prefix) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// clear drops all the entries.
+func (c *statCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]statCacheEntry)
+}
+
+// EnableStatCache makes Stat cache its results for ttl. Changes made through
+// the Volume, or through Files opened from it, invalidate the affected
+// entries, but changes made by other clients are only seen once the cached
+// entry expires. A ttl <= 0 disables the cache, which is the default.
+//
+// EnableStatCache must not be called concurrently with other operations on the Volume.
+func (v *Volume) EnableStatCache(ttl time.Duration) {
+	if ttl <= 0 {
+		v.statCache = nil
+		return
+	}
+	v.statCache = newStatCache(v, ttl)
+}
+
+// InvalidateStatCache drops the cached Stat result for name and, in case name
+// is a directory, for everything below it. It does nothing if the cache is disabled.
+func (v *Volume) InvalidateStatCache(name string) {
+	if v.statCache != nil {
+		v.statCache.invalidate(name, true)
+	}
+}
+
+// clearStatCache drops all the cached Stat results, e.g. because relative
+// names resolve differently after a change of the working directory.
+func (v *Volume) clearStatCache() {
+	if v.statCache != nil {
+		v.statCache.clear()
+	}
+}
+
+// invalidateStat drops the cached Stat results for names and their parent
+// directories, whose times and link counts change along with their entries.
+func (v *Volume) invalidateStat(names ...string) {
+	if v.statCache == nil {
+		return
+	}
+	for _, name := range names {
+		v.statCache.invalidate(name, true)
+		v.statCache.invalidate(path.Dir(path.Clean(name)), false)
+	}
+}
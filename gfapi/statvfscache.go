@@ -0,0 +1,94 @@
+package gfapi
+
+// This file includes the optional cache of Volume.Statvfs results
+
+import (
+	"path"
+	"sync"
+	"time"
+)
+
+// statvfser performs an uncached statvfs of a path.
+type statvfser interface {
+	statvfs(path string, buf *Statvfs_t) error
+}
+
+type statvfsCacheEntry struct {
+	buf     Statvfs_t
+	expires time.Time
+}
+
+// statvfsCache caches successful statvfs results of paths for a fixed
+// duration. Only a handful of paths are expected, such as the root probed
+// for readiness, so expired entries are simply overwritten.
+type statvfsCache struct {
+	src statvfser
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]statvfsCacheEntry
+}
+
+func newStatvfsCache(src statvfser, ttl time.Duration) *statvfsCache {
+	return &statvfsCache{
+		src:     src,
+		ttl:     ttl,
+		entries: make(map[string]statvfsCacheEntry),
+	}
+}
+
+// statvfs fills buf with the cached result for name if it has not expired
+// yet, and otherwise calls the source and caches the result.
+func (c *statvfsCache) statvfs(name string, buf *Statvfs_t) error {
+	key := path.Clean(name)
+	now := time.Now()
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		*buf = e.buf
+		return nil
+	}
+
+	if err := c.src.statvfs(name, buf); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.entries[key] = statvfsCacheEntry{buf: *buf, expires: now.Add(c.ttl)}
+	c.mu.Unlock()
+
+	return nil
+}
+
+// clear drops all the entries.
+func (c *statvfsCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]statvfsCacheEntry)
+}
+
+// EnableStatvfsCache makes Statvfs, and so DiskUsage, cache its results for
+// ttl, e.g. so that a probe checking the volume every second does not query
+// the bricks each time. Changes in usage are only seen once the cached entry
+// expires or InvalidateStatvfsCache is called. A ttl <= 0 disables the cache,
+// which is the default.
+//
+// EnableStatvfsCache must not be called concurrently with other operations on the Volume.
+func (v *Volume) EnableStatvfsCache(ttl time.Duration) {
+	if ttl <= 0 {
+		v.statvfsCache = nil
+		return
+	}
+	v.statvfsCache = newStatvfsCache(v, ttl)
+}
+
+// InvalidateStatvfsCache drops all the cached Statvfs results. It does
+// nothing if the cache is disabled.
+func (v *Volume) InvalidateStatvfsCache() {
+	if v.statvfsCache != nil {
+		v.statvfsCache.clear()
+	}
+}
@@ -0,0 +1,272 @@
+package gfapi
+
+// This file includes the export and import of Volume subtrees as tar archives
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// paxXattrPrefix is the PAX record prefix used for extended attributes, as
+// written by GNU tar and star.
+const paxXattrPrefix = "SCHILY.xattr."
+
+// TarTo writes the tree rooted at root to w as a tar archive. Directories,
+// regular files, symbolic links and hard links are archived with their
+// modes, owners and modification times, and the extended attributes of
+// directories and regular files are stored as PAX records. Other file types
+// are skipped.
+//
+// The entries are named relative to root, which itself is not archived unless
+// it is a file. File contents are streamed, so files of any size can be archived.
+//
+// Returns the first error encountered
+func (v *Volume) TarTo(w io.Writer, root string) error {
+	tw := tar.NewWriter(w)
+	// links maps the inodes of files with several links to their first entry.
+	links := make(map[uint64]string)
+
+	err := v.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel := strings.TrimPrefix(strings.TrimPrefix(name, root), "/")
+		if rel == "" {
+			if d.IsDir() {
+				return nil
+			}
+			rel = path.Base(name)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return v.tarEntry(tw, name, rel, info, links)
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// tarEntry writes the file name, described by info, to tw as the entry rel.
+func (v *Volume) tarEntry(tw *tar.Writer, name, rel string, info os.FileInfo, links map[uint64]string) error {
+	var target string
+	mode := info.Mode()
+
+	switch {
+	case mode.IsRegular(), mode.IsDir():
+	case mode&os.ModeSymlink != 0:
+		var err error
+		if target, err = v.Readlink(name); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	hdr, err := tar.FileInfoHeader(info, target)
+	if err != nil {
+		return err
+	}
+	hdr.Name = rel
+	if mode.IsDir() {
+		hdr.Name += "/"
+	}
+
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && mode.IsRegular() && st.Nlink > 1 {
+		if first, ok := links[uint64(st.Ino)]; ok {
+			hdr.Typeflag = tar.TypeLink
+			hdr.Linkname = first
+			hdr.Size = 0
+			return tw.WriteHeader(hdr)
+		}
+		links[uint64(st.Ino)] = hdr.Name
+	}
+
+	if mode.IsRegular() || mode.IsDir() {
+		if err := v.tarXattrs(hdr, name); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !mode.IsRegular() {
+		return nil
+	}
+
+	f, err := v.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = v.ioBuffers().copyN(tw, f, hdr.Size)
+	return err
+}
+
+// tarXattrs adds the extended attributes of the file name to hdr as PAX records.
+func (v *Volume) tarXattrs(hdr *tar.Header, name string) error {
+	attrs, err := v.GetAllXattrs(name)
+	if err != nil {
+		return err
+	}
+
+	for attr, value := range attrs {
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = make(map[string]string)
+		}
+		hdr.PAXRecords[paxXattrPrefix+attr] = string(value)
+		hdr.Format = tar.FormatPAX
+	}
+	return nil
+}
+
+// UntarFrom reads a tar archive from r and recreates its entries below dest,
+// which is created if needed. Directories, regular files, symbolic links and
+// hard links are restored with their modes and modification times, along
+// with the extended attributes stored as PAX records. Owners are not
+// restored and other entry types are skipped.
+//
+// Entries whose names would escape dest are rejected.
+//
+// Returns the first error encountered
+func (v *Volume) UntarFrom(r io.Reader, dest string) error {
+	// Directory times are set last, as creating their entries changes them.
+	type dirTime struct {
+		name  string
+		mtime time.Time
+	}
+	var dirs []dirTime
+
+	if err := v.MkdirAll(dest, 0777); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name, err := untarPath(dest, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if name == dest {
+			continue
+		}
+
+		if err := v.MkdirAll(path.Dir(name), 0777); err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = v.untarDir(name, hdr)
+			dirs = append(dirs, dirTime{name, hdr.ModTime})
+		case tar.TypeReg:
+			err = v.untarFile(name, hdr, tr)
+		case tar.TypeSymlink:
+			v.Unlink(name)
+			err = v.Symlink(hdr.Linkname, name)
+		case tar.TypeLink:
+			var target string
+			if target, err = untarPath(dest, hdr.Linkname); err == nil {
+				v.Unlink(name)
+				err = v.Link(target, name)
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := v.Chtimes(dirs[i].name, dirs[i].mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// untarPath returns the path below dest for the tar entry name, rejecting
+// names which would escape dest.
+func untarPath(dest, name string) (string, error) {
+	rel := strings.TrimPrefix(strings.TrimSuffix(name, "/"), "./")
+	if rel == "." || rel == "" {
+		return dest, nil
+	}
+	if !fs.ValidPath(rel) {
+		return "", fmt.Errorf("tar entry %q is outside of %q", name, dest)
+	}
+	return path.Join(dest, rel), nil
+}
+
+// untarDir creates the directory name described by hdr.
+func (v *Volume) untarDir(name string, hdr *tar.Header) error {
+	if err := v.MkdirAll(name, 0700); err != nil {
+		return err
+	}
+	if err := v.Chmod(name, hdr.FileInfo().Mode()); err != nil {
+		return err
+	}
+	return v.untarXattrs(name, hdr)
+}
+
+// untarFile creates the regular file name described by hdr with the content read from r.
+func (v *Volume) untarFile(name string, hdr *tar.Header, r io.Reader) error {
+	f, err := v.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = v.ioBuffers().copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := v.Chmod(name, hdr.FileInfo().Mode()); err != nil {
+		return err
+	}
+	if err := v.untarXattrs(name, hdr); err != nil {
+		return err
+	}
+	return v.Chtimes(name, hdr.ModTime)
+}
+
+// untarXattrs sets the extended attributes stored in the PAX records of hdr on name.
+func (v *Volume) untarXattrs(name string, hdr *tar.Header) error {
+	attrs := make(map[string][]byte)
+	for key, value := range hdr.PAXRecords {
+		if attr, ok := strings.CutPrefix(key, paxXattrPrefix); ok {
+			attrs[attr] = []byte(value)
+		}
+	}
+
+	if errs := v.SetAllXattrs(name, attrs, 0); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
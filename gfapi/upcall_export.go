@@ -0,0 +1,15 @@
+package gfapi
+
+// This file includes the callback gfapi calls with upcalls. It is kept apart
+// from watch.go, as cgo only allows declarations in the preamble of files
+// with exported functions.
+
+// #include <stdint.h>
+import "C"
+
+import "unsafe"
+
+//export goUpcallCallback
+func goUpcallCallback(arg unsafe.Pointer, data C.uintptr_t) {
+	upcallCallback(arg, uint64(data))
+}
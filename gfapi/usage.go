@@ -0,0 +1,76 @@
+package gfapi
+
+// This file includes helpers reporting the space and inode usage of a Volume
+
+import (
+	"encoding/binary"
+	"os"
+)
+
+// Quota extended attributes maintained by the gluster quota feature.
+const (
+	quotaLimitXattr = "trusted.glusterfs.quota.limit-set"
+	quotaSizeXattr  = "trusted.glusterfs.quota.size"
+)
+
+// DiskUsage describes the space and inode usage of the filesystem backing a Volume.
+type DiskUsage struct {
+	// Size, Free and Avail are in bytes. Avail is the space available to
+	// unprivileged users, which may be less than Free.
+	Size  uint64
+	Free  uint64
+	Avail uint64
+
+	// Files and FilesFree are the total and free number of inodes.
+	Files     uint64
+	FilesFree uint64
+}
+
+// DiskUsage returns the space and inode usage of the filesystem containing path
+//
+// Returns an error on failure
+func (v *Volume) DiskUsage(path string) (*DiskUsage, error) {
+	var buf Statvfs_t
+	if err := v.Statvfs(path, &buf); err != nil {
+		return nil, &os.PathError{Op: "statvfs", Path: path, Err: err}
+	}
+
+	return &DiskUsage{
+		Size:      uint64(buf.Blocks) * uint64(buf.Frsize),
+		Free:      uint64(buf.Bfree) * uint64(buf.Frsize),
+		Avail:     uint64(buf.Bavail) * uint64(buf.Frsize),
+		Files:     uint64(buf.Files),
+		FilesFree: uint64(buf.Ffree),
+	}, nil
+}
+
+// GetQuota returns the hard limit and the current usage in bytes of the
+// directory quota set on path, read from the xattrs the gluster quota feature
+// maintains. Reading them usually requires privileges.
+//
+// Returns an error on failure, wrapping syscall.ENODATA if no quota is set on path
+func (v *Volume) GetQuota(path string) (limit, used int64, err error) {
+	value, err := xattrBuffer(func(dest []byte) (int64, error) {
+		return v.Getxattr(path, quotaLimitXattr, dest)
+	})
+	if err != nil {
+		return 0, 0, &os.PathError{Op: "getxattr", Path: path, Err: err}
+	}
+	if len(value) < 8 {
+		return 0, 0, &os.PathError{Op: "getxattr", Path: path, Err: errBadQuotaXattr}
+	}
+	limit = int64(binary.BigEndian.Uint64(value))
+
+	value, err = xattrBuffer(func(dest []byte) (int64, error) {
+		return v.Getxattr(path, quotaSizeXattr, dest)
+	})
+	if err != nil {
+		return 0, 0, &os.PathError{Op: "getxattr", Path: path, Err: err}
+	}
+	if len(value) < 8 {
+		return 0, 0, &os.PathError{Op: "getxattr", Path: path, Err: errBadQuotaXattr}
+	}
+	used = int64(binary.BigEndian.Uint64(value))
+
+	return limit, used, nil
+}
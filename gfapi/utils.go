@@ -2,9 +2,19 @@ package gfapi
 
 // This file includes some helper functions used internally by the package
 
+// #include <sys/types.h>
+// #include <sys/stat.h>
+// #include <time.h>
+import "C"
+
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -26,6 +36,162 @@ func posixMode(i os.FileMode) (o uint32) {
 	return
 }
 
+// cuid() converts a Go uid to a C.uid_t, keeping -1 as the (uid_t)-1 value
+// chown interprets as "leave the owner unchanged"
+func cuid(uid int) C.uid_t {
+	if uid == -1 {
+		return ^C.uid_t(0)
+	}
+	return C.uid_t(uid)
+}
+
+// cgid() converts a Go gid to a C.gid_t, keeping -1 as the (gid_t)-1 value
+// chown interprets as "leave the group unchanged"
+func cgid(gid int) C.gid_t {
+	if gid == -1 {
+		return ^C.gid_t(0)
+	}
+	return C.gid_t(gid)
+}
+
+// readlinkBuffer() calls readlink with a growing buffer until the whole link
+// destination fits, and returns the destination
+//
+// Based on the implementation of os.Readlink in the Go source
+func readlinkBuffer(readlink func(buf []byte) (int, error)) (string, error) {
+	for size := 128; ; size *= 2 {
+		buf := make([]byte, size)
+		n, err := readlink(buf)
+		if n < 0 {
+			return "", err
+		}
+		if n < size {
+			return string(buf[:n]), nil
+		}
+	}
+}
+
+// xattrBuffer() calls get with a buffer sized by a first call with an empty
+// buffer, retrying if the value grows in between, and returns the value
+func xattrBuffer(get func(dest []byte) (int64, error)) ([]byte, error) {
+	for {
+		size, err := get(nil)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return []byte{}, nil
+		}
+
+		buf := make([]byte, size)
+		n, err := get(buf)
+		if err == syscall.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
+
+// privilegedXattrNamespaces describes the extended attribute namespaces
+// access to which is restricted beyond the permissions of the file.
+var privilegedXattrNamespaces = map[string]string{
+	"security": "writing requires CAP_SYS_ADMIN",
+	"system":   "writing ACLs requires owning the file",
+	"trusted":  "reading and writing require CAP_SYS_ADMIN",
+}
+
+// xattrError() returns the error for the failed access to the extended
+// attribute attr with errno err, wrapping ErrXattrPermission as well as err
+// if the access was denied, and err itself otherwise
+func xattrError(attr string, err error) error {
+	if err != syscall.EPERM && err != syscall.EACCES {
+		return err
+	}
+	ns, _, _ := strings.Cut(attr, ".")
+	if why, ok := privilegedXattrNamespaces[ns]; ok {
+		return fmt.Errorf("%w: %s.* namespace, %s: %w", ErrXattrPermission, ns, why, err)
+	}
+	return fmt.Errorf("%w: %w", ErrXattrPermission, err)
+}
+
+// xattrNames() splits a list of NUL terminated extended attribute names as
+// returned by Listxattr
+func xattrNames(list []byte) []string {
+	var names []string
+	for len(list) > 0 {
+		i := bytes.IndexByte(list, 0)
+		if i < 0 {
+			i = len(list)
+		}
+		if i > 0 {
+			names = append(names, string(list[:i]))
+		}
+		list = list[min(i+1, len(list)):]
+	}
+	return names
+}
+
+// direntType() returns the os.FileMode type bits for the file type of a
+// dirent, or os.ModeIrregular if the type is unknown
+func direntType(dirent *syscall.Dirent) os.FileMode {
+	switch dirent.Type {
+	case syscall.DT_BLK:
+		return os.ModeDevice
+	case syscall.DT_CHR:
+		return os.ModeDevice | os.ModeCharDevice
+	case syscall.DT_DIR:
+		return os.ModeDir
+	case syscall.DT_FIFO:
+		return os.ModeNamedPipe
+	case syscall.DT_LNK:
+		return os.ModeSymlink
+	case syscall.DT_REG:
+		return 0
+	case syscall.DT_SOCK:
+		return os.ModeSocket
+	}
+	return os.ModeIrregular
+}
+
+// dirEntry is an implementation of the fs.DirEntry interface for entries
+// read from the directory dir
+type dirEntry struct {
+	dir  *File
+	name string
+	typ  os.FileMode
+}
+
+func (de *dirEntry) Name() string {
+	return de.name
+}
+
+func (de *dirEntry) IsDir() bool {
+	return de.typ.IsDir()
+}
+
+func (de *dirEntry) Type() fs.FileMode {
+	return de.typ
+}
+
+// Info() stats the entry relative to the directory it was read from. The
+// full path is only used if that is not possible, because the directory has
+// been closed or the *at calls are unsupported.
+func (de *dirEntry) Info() (fs.FileInfo, error) {
+	info, err := de.dir.Statat(de.name, AT_SYMLINK_NOFOLLOW)
+	if err == nil || de.dir.vol == nil ||
+		!(errors.Is(err, ErrUnsupported) || errors.Is(err, os.ErrClosed)) {
+		return info, err
+	}
+	return de.dir.vol.Lstat(path.Join(de.dir.name, de.name))
+}
+
+func (de *dirEntry) String() string {
+	return fs.FormatDirEntry(de)
+}
+
 // fileInfo is an implementation of the os.FileInfo interface
 //
 // Based on the implementation of fileStat structure in the pkg/os/types_notwin.go file of the Go source
@@ -62,6 +228,7 @@ func (fs *fileInfo) Sys() interface{} {
 }
 
 // fileInfoFromStat() returns an os.FileInfo struct from the given syscall.Stat_t struc
+// name may be a full path, the os.FileInfo is named after its final element like os.Stat does
 //
 // Based on the fileInfoFromStat function in the pkg/os/stat_linux.go file in the Go source
 func fileInfoFromStat(st *syscall.Stat_t, name string) os.FileInfo {
@@ -100,6 +267,31 @@ func fileInfoFromStat(st *syscall.Stat_t, name string) os.FileInfo {
 	return fs
 }
 
+// TimeOmit and TimeNow can be passed as either time to the utimens family of
+// operations, such as Volume.Utimens and File.Futimens, to leave that time
+// unchanged or to set it to the current time, like UTIME_OMIT and UTIME_NOW.
+var (
+	TimeOmit = time.Time{}.Add(1)
+	TimeNow  = time.Time{}.Add(2)
+)
+
+// timespecs() converts an atime and mtime to the timespecs of the utimens
+// family, translating TimeOmit and TimeNow
+func timespecs(atime, mtime time.Time) [2]C.struct_timespec {
+	var times [2]C.struct_timespec
+	for i, t := range [2]time.Time{atime, mtime} {
+		switch {
+		case t.Equal(TimeOmit):
+			times[i] = C.struct_timespec{tv_nsec: C.UTIME_OMIT}
+		case t.Equal(TimeNow):
+			times[i] = C.struct_timespec{tv_nsec: C.UTIME_NOW}
+		default:
+			times[i] = C.struct_timespec{tv_sec: C.long(t.Unix()), tv_nsec: C.long(t.Nanosecond())}
+		}
+	}
+	return times
+}
+
 // timespecToTime() converts a given syscall.Timespec to time.Time
 //
 // Copied from pkg/os/stat_linux.go in the Go source
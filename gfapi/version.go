@@ -0,0 +1,89 @@
+package gfapi
+
+// This file includes helpers to find out which version of libgfapi is in use
+
+// #cgo pkg-config: glusterfs-api
+// #cgo linux LDFLAGS: -ldl
+// #define _GNU_SOURCE
+// #include <dlfcn.h>
+// #include <stdlib.h>
+// #include "glusterfs/api/glfs.h"
+//
+// static const char *compiled_version(void) {
+// #ifdef GFAPI_VERSION
+// 	return GFAPI_VERSION;
+// #else
+// 	return "";
+// #endif
+// }
+//
+// static void *lookup_symbol(const char *name) {
+// 	return dlsym(RTLD_DEFAULT, name);
+// }
+import "C"
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// versionMarkers lists, newest first, a symbol introduced by each libgfapi
+// API version. The first one present in the loaded library gives its version.
+var versionMarkers = []struct {
+	symbol  string
+	version string
+}{
+	{"glfs_openat", "11.0"},
+	{"glfs_setfspid", "6.1"},
+	{"glfs_copy_file_range", "6.0"},
+	{"glfs_lease", "4.0.0"},
+	{"glfs_upcall_register", "3.13.0"},
+	{"glfs_xreaddirplus_r", "3.11.0"},
+	{"glfs_new", "3.4.0"},
+}
+
+var (
+	runtimeVersionOnce sync.Once
+	runtimeVersion     string
+)
+
+// lookupSymbol returns the address of the named symbol in the running
+// process, or nil if the loaded libgfapi does not export it.
+func lookupSymbol(name string) unsafe.Pointer {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	return C.lookup_symbol(cname)
+}
+
+// hasSymbol reports whether the loaded libgfapi exports the named symbol.
+func hasSymbol(name string) bool {
+	return lookupSymbol(name) != nil
+}
+
+// GlusterVersion returns the libgfapi API version in use, such as "6.0".
+//
+// The version is that of the library loaded at runtime, found by probing for
+// the symbols each API version introduced. It is therefore the newest API
+// version the library fully provides, which may be older than the GlusterFS
+// release. See CompiledGlusterVersion for the version of the headers.
+func GlusterVersion() string {
+	runtimeVersionOnce.Do(func() {
+		for _, m := range versionMarkers {
+			if hasSymbol(m.symbol) {
+				runtimeVersion = m.version
+				return
+			}
+		}
+	})
+
+	return runtimeVersion
+}
+
+// CompiledGlusterVersion returns the libgfapi version of the headers the
+// package was compiled against, from their GFAPI_VERSION macro, or "" if the
+// headers don't define it. The library loaded at runtime may differ, see
+// GlusterVersion.
+func CompiledGlusterVersion() string {
+	return C.GoString(C.compiled_version())
+}
@@ -10,16 +10,39 @@ package gfapi
 
 // #cgo pkg-config: glusterfs-api
 // #include "glusterfs/api/glfs.h"
+// #include <limits.h>
 // #include <stdlib.h>
 // #include <time.h>
 // #include <sys/stat.h>
+//
+// typedef int (*unset_volfile_server_fn)(glfs_t *, const char *, const char *, int);
+//
+// static int call_unset_volfile_server(void *fn, glfs_t *fs, const char *transport, const char *host, int port) {
+// 	return ((unset_volfile_server_fn)fn)(fs, transport, host, port);
+// }
+//
+// typedef ssize_t (*copy_file_range_fn)(glfs_fd_t *, off_t *, glfs_fd_t *, off_t *, size_t, unsigned int, struct stat *, struct glfs_stat *, struct glfs_stat *);
+//
+// static ssize_t call_copy_file_range(void *fn, glfs_fd_t *fd_in, off_t *off_in, glfs_fd_t *fd_out, off_t *off_out, size_t len) {
+// 	return ((copy_file_range_fn)fn)(fd_in, off_in, fd_out, off_out, len, 0, NULL, NULL, NULL);
+// }
 import "C"
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"math/rand/v2"
 	"os"
+	"os/user"
 	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -28,7 +51,36 @@ import (
 
 // Volume is the gluster filesystem object, which represents the virtual filesystem.
 type Volume struct {
-	fs *C.glfs_t
+	fs      *C.glfs_t
+	mounted bool
+
+	// volname and setup record how fs was created and configured before
+	// Mount, so that MountRetry can build a fresh glfs object the same way.
+	volname string
+	setup   []func() error
+
+	// ops tracks the operations running in the background, which Unmount
+	// waits for.
+	ops opTracker
+
+	pathLocks pathLocks
+
+	statCache    *statCache
+	statvfsCache *statvfsCache
+
+	// umask holds the permission bits cleared from the mode of the files
+	// and directories created through the Volume, see Umask.
+	umask uint32
+
+	// buffers is the pool of copy buffers set up by SetIOBufferSize, or nil
+	// to use that of the package.
+	buffers *bufferPool
+
+	// retryStale makes lookups retry once on ESTALE, see SetRetryStale.
+	retryStale bool
+
+	// watch tracks the watchers started with Watch.
+	watch watchState
 }
 
 // Init creates a new glfs object "Volume". Volname is the name of the Gluster Volume
@@ -45,25 +97,123 @@ func (v *Volume) Init(volname string, hosts ...string) error {
 	if v.fs == nil {
 		return fmt.Errorf("error creating mount object")
 	}
+	v.volname, v.setup = volname, nil
 
 	for i, host := range hosts {
-		ctrans := C.CString("tcp")
+		transport := "tcp"
 		if strings.HasSuffix(host, ".socket") {
-			ctrans = C.CString("unix")
+			transport = "unix"
 		}
-		chost := C.CString(host)
+		if err := v.AddVolfileServer(transport, host, 24007); err != nil {
+			return fmt.Errorf("error adding host %d of %d %q as a volserver: %s", i, len(hosts), host, err)
+		}
+	}
+
+	return nil
+}
+
+// NewVolume returns a new Volume initialized with Init, ready to be mounted.
+// It saves allocating the Volume and calling Init separately.
+//
+// Returns an error on failure
+func NewVolume(volname string, hosts ...string) (*Volume, error) {
+	v := new(Volume)
+	if err := v.Init(volname, hosts...); err != nil {
+		v.Unmount()
+		return nil, err
+	}
+	return v, nil
+}
+
+// OpenVolume is like NewVolume, but also mounts the Volume, so that it is
+// ready for storage operations. The Volume must be released with Unmount.
+//
+// Returns an error on failure
+func OpenVolume(volname string, hosts ...string) (*Volume, error) {
+	v, err := NewVolume(volname, hosts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.Mount(); err != nil {
+		v.Unmount()
+		return nil, err
+	}
+	return v, nil
+}
+
+// AddVolfileServer adds a volfile server (management server/glusterd) to the
+// list of servers the volfile is fetched from. It must be called after Init
+// and before Mount, and can be used to build the server list when Init is
+// given no hosts.
+//
+// transport is one of "tcp", "unix" or "rdma". For "unix", host is the path
+// to the socket and port is ignored.
+//
+// Returns an error on failure
+func (v *Volume) AddVolfileServer(transport, host string, port int) error {
+	if err := checkTransport(transport); err != nil {
+		return err
+	}
+	if v.fs == nil {
+		return errors.New("volume is not initialized")
+	}
+
+	return v.configure(func() error {
+		ctrans := C.CString(transport)
 		defer C.free(unsafe.Pointer(ctrans))
+		chost := C.CString(host)
 		defer C.free(unsafe.Pointer(chost))
+
 		// NOTE: This API is special, multiple calls to this function with different
 		// volfile servers, port or transport-type would create a list of volfile
 		// servers which would be polled during `volfile_fetch_attempts()`
-		ret, err := C.glfs_set_volfile_server(v.fs, ctrans, chost, 24007)
+		ret, err := C.glfs_set_volfile_server(v.fs, ctrans, chost, C.int(port))
 		if int(ret) < 0 {
-			return fmt.Errorf("error adding host %d of %d %q as a volserver: %s", i, len(hosts), host, err)
+			return err
 		}
+		return nil
+	})
+}
+
+// UnsetVolfileServer removes a volfile server added by Init or
+// AddVolfileServer, e.g. to drop an unreachable server before a remount.
+// The arguments must match those the server was added with.
+//
+// Returns syscall.ENOTSUP, which matches ErrUnsupported, if the loaded
+// libgfapi lacks the call, and an error on failure
+func (v *Volume) UnsetVolfileServer(transport, host string, port int) error {
+	fn := featureFunc(FeatureUnsetVolfileServer)
+	if fn == nil {
+		return syscall.ENOTSUP
+	}
+	if err := checkTransport(transport); err != nil {
+		return err
+	}
+	if v.fs == nil {
+		return errors.New("volume is not initialized")
 	}
 
-	return nil
+	return v.configure(func() error {
+		ctrans := C.CString(transport)
+		defer C.free(unsafe.Pointer(ctrans))
+		chost := C.CString(host)
+		defer C.free(unsafe.Pointer(chost))
+
+		ret, err := C.call_unset_volfile_server(fn, v.fs, ctrans, chost, C.int(port))
+		if int(ret) < 0 {
+			return err
+		}
+		return nil
+	})
+}
+
+// checkTransport checks that transport is a volfile server transport gfapi supports.
+func checkTransport(transport string) error {
+	switch transport {
+	case "tcp", "unix", "rdma":
+		return nil
+	}
+	return fmt.Errorf("invalid volfile server transport %q", transport)
 }
 
 // InitWithVolfile initializes the Volume using the given volfile.
@@ -74,17 +224,64 @@ func (v *Volume) Init(volname string, hosts ...string) error {
 // Return value is 0 for success and non 0 for failure
 func (v *Volume) InitWithVolfile(volname, volfile string) int {
 	cvolname := C.CString(volname)
-	cvolfile := C.CString(volfile)
 	defer C.free(unsafe.Pointer(cvolname))
-	defer C.free(unsafe.Pointer(cvolfile))
 
 	v.fs = C.glfs_new(cvolname)
+	v.volname, v.setup = volname, nil
 
-	ret := C.glfs_set_volfile(v.fs, cvolfile)
+	var ret C.int
+	v.configure(func() error {
+		cvolfile := C.CString(volfile)
+		defer C.free(unsafe.Pointer(cvolfile))
+
+		var err error
+		if ret, err = C.glfs_set_volfile(v.fs, cvolfile); ret != 0 {
+			return fmt.Errorf("setting volfile %q: %w", volfile, err)
+		}
+		return nil
+	})
 
 	return int(ret)
 }
 
+// configure runs set, which configures the glfs object before Mount, and
+// records it to configure the fresh objects MountRetry builds the same way.
+func (v *Volume) configure(set func() error) error {
+	if err := set(); err != nil {
+		return err
+	}
+	v.setup = append(v.setup, set)
+	return nil
+}
+
+// reinit replaces the glfs object of the Volume, which failed to mount, with
+// a new one configured the same way, as gfapi cannot run glfs_init again on
+// an object it failed on: each attempt would leave another graph and poller
+// thread behind.
+func (v *Volume) reinit() error {
+	if v.volname == "" {
+		return errors.New("volume is not initialized")
+	}
+	if v.fs != nil {
+		C.glfs_fini(v.fs)
+		v.fs = nil
+	}
+
+	cvolname := C.CString(v.volname)
+	defer C.free(unsafe.Pointer(cvolname))
+
+	v.fs = C.glfs_new(cvolname)
+	if v.fs == nil {
+		return fmt.Errorf("error creating mount object")
+	}
+	for _, set := range v.setup {
+		if err := set(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Mount establishes a 'virtual mount.' Mount must be called after Init and
 // before storage operations. Steps taken:
 //
@@ -95,12 +292,202 @@ func (v *Volume) InitWithVolfile(volname, volfile string) int {
 //
 // Source: glfs.h
 func (v *Volume) Mount() error {
+	if v.mounted {
+		return errors.New("volume is already mounted")
+	}
+	if v.fs == nil {
+		return errors.New("volume is not initialized")
+	}
 
 	ret, err := C.glfs_init(v.fs)
 	if int(ret) < 0 {
 		return fmt.Errorf("mount failed: %s", err)
 	}
 
+	v.mounted = true
+	return nil
+}
+
+// Umask sets the umask of the Volume to the permission bits of mask, and
+// returns the previous one, like syscall.Umask. The umask is cleared from the
+// permission bits passed to the operations creating files and directories,
+// such as OpenFile, Create and Mkdir. It defaults to 0: gfapi does not apply
+// the umask of the process, so the permission bits reach the bricks as given.
+//
+// Umask must not be called concurrently with other operations on the Volume.
+func (v *Volume) Umask(mask os.FileMode) os.FileMode {
+	old := os.FileMode(v.umask)
+	v.umask = uint32(mask.Perm())
+	return old
+}
+
+// createMode() returns the mode to create a file or directory with the
+// permission bits perm with, less the umask. Other bits of perm, such as
+// os.ModeDir, are ignored. v may be nil, for Files not opened from a Volume.
+func (v *Volume) createMode(perm os.FileMode) C.mode_t {
+	mode := posixMode(perm)
+	if v != nil {
+		mode &^= v.umask
+	}
+	return C.mode_t(mode)
+}
+
+// SetIOBufferSize sets the size of the buffers the copying helpers move data
+// through when used with the Volume or its Files, such as CopyTo, CopyFrom,
+// CopyFile, TarTo, UntarFrom and File.Checksum, overriding SetBufferSize.
+// Larger buffers mean fewer cgo calls and round trips for large files on
+// fast networks, at the cost of memory for each copy in progress. Sizes below
+// 4 KiB are raised to 4 KiB, and n <= 0 goes back to the size of the package,
+// 128 KiB by default. The buffers are pooled per Volume.
+//
+// ReadFile is not affected, as it reads into a buffer sized after the file.
+//
+// SetIOBufferSize must not be called concurrently with other operations on the Volume.
+func (v *Volume) SetIOBufferSize(n int) {
+	if n <= 0 {
+		v.buffers = nil
+		return
+	}
+	v.buffers = newBufferPool(n)
+}
+
+// ioBuffers returns the pool of copy buffers of the Volume, see
+// SetIOBufferSize. v may be nil, for Files not opened from a Volume.
+func (v *Volume) ioBuffers() *bufferPool {
+	if v == nil || v.buffers == nil {
+		return buffers
+	}
+	return v.buffers
+}
+
+// SetRetryStale sets whether Open, OpenFile, Stat and Lstat retry once when
+// they fail with ESTALE, which they do when the file handle resolved from the
+// path went stale on the servers, as is common while the volume rebalances
+// or bricks migrate. The retry resolves the path afresh, bypassing the stat
+// cache. Exclusive creates are not retried. Retrying is off by default.
+//
+// SetRetryStale must not be called concurrently with other operations on the Volume.
+func (v *Volume) SetRetryStale(retry bool) {
+	v.retryStale = retry
+}
+
+// withStaleRetry() returns the result of op, calling it once more if it
+// failed with ESTALE and the Volume retries, after dropping the cached stat
+// of name so the retry resolves it again
+func withStaleRetry[T any](v *Volume, name string, op func() (T, error)) (T, error) {
+	res, err := op()
+	if err != nil && v.retryStale && errors.Is(err, syscall.ESTALE) {
+		v.invalidateStat(name)
+		res, err = op()
+	}
+	return res, err
+}
+
+// checkMounted returns an os.PathError for op on name wrapping ErrNotMounted
+// if the Volume is not mounted, so that operations fail instead of handing
+// gfapi an unusable or freed glfs object.
+func (v *Volume) checkMounted(op, name string) error {
+	if !v.mounted {
+		return &os.PathError{Op: op, Path: name, Err: ErrNotMounted}
+	}
+	return nil
+}
+
+// mountVolume and reinitVolume mount a Volume and rebuild its glfs object
+// for MountRetry, and can be replaced in tests.
+var (
+	mountVolume  = (*Volume).Mount
+	reinitVolume = (*Volume).reinit
+)
+
+// MountRetry is like Mount, but makes up to attempts attempts to mount the
+// Volume, e.g. to wait for glusterd to become available when starting up
+// along with the cluster. It waits backoff after the first failed attempt and
+// doubles the wait after each further one.
+//
+// A glfs object cannot be mounted again once mounting it failed, so before
+// each further attempt the object is freed and a new one is created with the
+// volume name and settings given to Init, AddVolfileServer, SetXlatorOption
+// and the like. The Volume must have been initialized with Init or
+// InitWithVolfile.
+//
+// Returns the error of the last attempt if all of them fail
+func (v *Volume) MountRetry(attempts int, backoff time.Duration) error {
+	var err error
+	for i := 0; i < attempts || i == 0; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+			if rerr := reinitVolume(v); rerr != nil {
+				return fmt.Errorf("%w (reinitializing after: %w)", rerr, err)
+			}
+		}
+		if err = mountVolume(v); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// SetXlatorOption sets the option key of the translators of the client
+// graph matching the pattern xlator to value, overriding the option of the
+// volfile. Patterns such as "*-write-behind" match translators whatever the
+// name of their volume. It must be called after Init and before Mount.
+//
+// Returns an error on failure
+func (v *Volume) SetXlatorOption(xlator, key, value string) error {
+	if v.fs == nil {
+		return errors.New("volume is not initialized")
+	}
+	if v.mounted {
+		return fmt.Errorf("xlator option %s.%s must be set before Mount", xlator, key)
+	}
+
+	return v.configure(func() error {
+		cxlator := C.CString(xlator)
+		defer C.free(unsafe.Pointer(cxlator))
+		ckey := C.CString(key)
+		defer C.free(unsafe.Pointer(ckey))
+		cvalue := C.CString(value)
+		defer C.free(unsafe.Pointer(cvalue))
+
+		ret, err := C.glfs_set_xlator_option(v.fs, cxlator, ckey, cvalue)
+		if int(ret) < 0 {
+			return fmt.Errorf("setting xlator option %s.%s to %q: %w", xlator, key, value, err)
+		}
+		return nil
+	})
+}
+
+// TuneReadahead enables or disables the client's read-ahead translator and,
+// if pageCount > 0, sets the number of pages it reads ahead (1 to 16).
+// Disabling puts the translator in pass-through mode. It must be called after
+// Init and before Mount.
+//
+// Returns an error on failure
+func (v *Volume) TuneReadahead(enabled bool, pageCount int) error {
+	if err := v.SetXlatorOption("*-read-ahead", "pass-through", strconv.FormatBool(!enabled)); err != nil {
+		return err
+	}
+	if enabled && pageCount > 0 {
+		return v.SetXlatorOption("*-read-ahead", "page-count", strconv.Itoa(pageCount))
+	}
+	return nil
+}
+
+// TuneWriteBehind enables or disables the client's write-behind translator
+// and, if windowSize > 0, sets the number of bytes it may buffer per file.
+// Disabling puts the translator in pass-through mode. It must be called after
+// Init and before Mount.
+//
+// Returns an error on failure
+func (v *Volume) TuneWriteBehind(enabled bool, windowSize int) error {
+	if err := v.SetXlatorOption("*-write-behind", "pass-through", strconv.FormatBool(!enabled)); err != nil {
+		return err
+	}
+	if enabled && windowSize > 0 {
+		return v.SetXlatorOption("*-write-behind", "cache-size", strconv.Itoa(windowSize))
+	}
 	return nil
 }
 
@@ -123,46 +510,107 @@ const (
 
 // SetLogging sets the gfapi log file path and LogLevel. The Volume must be
 // initialized before calling. An empty string "" is passed as 'name'
-// sets the default log directory (/var/log/glusterfs).
+// sets the default log directory (/var/log/glusterfs), and "-" logs to stderr.
+//
+// The log file is written on the local filesystem, so its directory is
+// checked to be writable up front rather than gfapi failing to log later.
 func (v *Volume) SetLogging(name string, logLevel LogLevel) error {
 
 	if name == "" {
-		ret, err := C.glfs_set_logging(v.fs, nil, C.int(logLevel))
+		return v.configure(func() error {
+			ret, err := C.glfs_set_logging(v.fs, nil, C.int(logLevel))
+			if int(ret) < 0 {
+				return err
+			}
+			return nil
+		})
+	}
+
+	if err := checkLogFile(name); err != nil {
+		return err
+	}
+
+	return v.configure(func() error {
+		cname := C.CString(name)
+		defer C.free(unsafe.Pointer(cname))
+
+		ret, err := C.glfs_set_logging(v.fs, cname, C.int(logLevel))
 		if int(ret) < 0 {
 			return err
 		}
 		return nil
-	}
+	})
+}
 
-	if _, err := os.Stat(path.Dir(name)); err != nil {
-		return err
+// checkLogFile checks that the log file name can be created or appended to.
+// "-", which makes gfapi log to stderr, needs no check.
+func checkLogFile(name string) error {
+	if name == "-" {
+		return nil
 	}
 
-	cname := C.CString(name)
-	defer C.free(unsafe.Pointer(cname))
+	dir := filepath.Dir(name)
+	if fi, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("log directory %q is not usable: %w", dir, err)
+	} else if !fi.IsDir() {
+		return fmt.Errorf("log directory %q is not a directory", dir)
+	}
 
-	ret, err := C.glfs_set_logging(v.fs, cname, C.int(logLevel))
-	if int(ret) < 0 {
-		return err
+	if _, err := os.Stat(name); err == nil {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			return fmt.Errorf("log file %q is not writable: %w", name, err)
+		}
+		return f.Close()
 	}
 
-	return nil
+	f, err := os.CreateTemp(dir, ".gfapi-log-probe-")
+	if err != nil {
+		return fmt.Errorf("log directory %q is not writable: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
 }
 
-// Unmount ends the virtual mount. Return
-// >0: filled N bytes of buffer
-// 0: no volfile available
-// <0: volfile length exceeds @len by N bytes (@buf unchanged)
+// Unmount ends the virtual mount with glfs_fini, which flushes the
+// outstanding writes and disconnects from the bricks and the volfile
+// servers. Unmounting a Volume that is not initialized, such as one already
+// unmounted, does nothing and returns nil.
+//
+// The glfs object is freed in any case, and the Volume has to be initialized
+// again before it can be mounted again.
+//
+// Operations still running in the background, such as opens abandoned by
+// OpenFileContext, are waited for for up to 30 seconds, see UnmountTimeout.
 func (v *Volume) Unmount() error {
+	return v.UnmountTimeout(defaultUnmountTimeout)
+}
+
+// UnmountTimeout is like Unmount, but waits for up to timeout for the
+// operations running in the background to complete. If some are still running
+// after that, the Volume is left mounted, as freeing the glfs object under
+// them could crash the process.
+//
+// Returns an error wrapping syscall.EBUSY if operations are still running
+func (v *Volume) UnmountTimeout(timeout time.Duration) error {
 	if v.fs == nil {
 		return nil
 	}
-	ret, err := C.glfs_fini(v.fs)
-	if err != nil {
-		return fmt.Errorf("failure to unmount volume: %v", err)
+	if n := v.ops.wait(timeout); n > 0 {
+		return fmt.Errorf("failure to unmount volume: %d operations still running: %w", n, syscall.EBUSY)
 	}
-	if int(ret) < 0 {
-		return fmt.Errorf("failure to unmount volume: volfile length exceeds")
+	// The watchers call into gfapi, so they must be gone before glfs_fini.
+	v.watch.closeAll()
+	v.clearStatCache()
+	v.InvalidateStatvfsCache()
+	ret, err := C.glfs_fini(v.fs)
+	v.fs = nil
+	v.mounted = false
+	if int(ret) != 0 {
+		if err == nil {
+			err = syscall.EIO
+		}
+		return fmt.Errorf("failure to unmount volume: %w", err)
 	}
 	return nil
 }
@@ -171,112 +619,531 @@ func (v *Volume) Unmount() error {
 //
 // Returns an error on failure
 func (v *Volume) Chmod(name string, mode os.FileMode) error {
+	if err := v.checkMounted("chmod", name); err != nil {
+		return err
+	}
+
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 
 	_, err := C.glfs_chmod(v.fs, cname, C.mode_t(posixMode(mode)))
+	v.invalidateStat(name)
 
 	return err
 }
 
-// Chmod changes the uid, gid of the named file
+// ChmodString is like Chmod, but takes the mode as an octal string, see ParseFileMode.
 //
 // Returns an error on failure
-func (v *Volume) Chown(name string, uid, gid int) error {
-	cname := C.CString(name)
-	defer C.free(unsafe.Pointer(cname))
-
-	_, err := C.glfs_chown(v.fs, cname, C.uid_t(uid), C.gid_t(gid))
-
-	return err
+func (v *Volume) ChmodString(name, mode string) error {
+	m, err := ParseFileMode(mode)
+	if err != nil {
+		return &os.PathError{Op: "chmod", Path: name, Err: err}
+	}
+	return v.Chmod(name, m)
 }
 
-// Chmod changes the mtime of the named file
+// ParseFileMode parses an octal permission string as accepted by chmod(1),
+// such as "0644" or "755", with an optional leading zero. The setuid, setgid
+// and sticky bits (04000, 02000 and 01000) are translated to their
+// os.FileMode bits.
 //
-// Returns an error on failure
-func (v *Volume) Chtimes(name string, mtime time.Time) error {
-	cname := C.CString(name)
-	defer C.free(unsafe.Pointer(cname))
-
-	var amtime [2]C.struct_timespec
-	amtime[1] = C.struct_timespec{tv_sec: C.long(mtime.Unix()), tv_nsec: C.long(mtime.Nanosecond())}
-	_, err := C.glfs_utimens(v.fs, cname, &amtime[0])
+// Returns an error if s is not an octal number of at most 07777
+func ParseFileMode(s string) (os.FileMode, error) {
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || n > 07777 {
+		return 0, fmt.Errorf("invalid file mode %q", s)
+	}
 
-	return err
+	mode := os.FileMode(n & 0777)
+	if n&syscall.S_ISUID != 0 {
+		mode |= os.ModeSetuid
+	}
+	if n&syscall.S_ISGID != 0 {
+		mode |= os.ModeSetgid
+	}
+	if n&syscall.S_ISVTX != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
 }
 
-// Create creates a file with given name on the the Volume v.
-// The Volume must be mounted before calling Create.
-// Create is similar to os.Create in its functioning.
-//
-// name is the name of the file to be create.
+// Chown changes the uid, gid of the named file.
+// A uid or gid of -1 leaves that id unchanged.
 //
-// Returns a File object on success and a os.PathError on failure.
-func (v *Volume) Create(name string) (*File, error) {
-	cname := C.CString(name)
-	defer C.free(unsafe.Pointer(cname))
-
-	cfd, err := C.glfs_creat(v.fs, cname, C.int(os.O_RDWR|os.O_CREATE|os.O_TRUNC), 0666)
-
-	if cfd == nil {
-		return nil, &os.PathError{"create", name, err}
+// Returns an error on failure
+func (v *Volume) Chown(name string, uid, gid int) error {
+	if err := v.checkMounted("chown", name); err != nil {
+		return err
 	}
 
-	return NewFile(name, &Glfs{cfd}, false), nil
-}
-
-// Unlink attempts to unlink a file a path and returns a non-nil error on failure.
-func (v *Volume) Unlink(path string) error {
-
-	cpath := C.CString(path)
-	defer C.free(unsafe.Pointer(cpath))
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
 
-	ret, err := C.glfs_unlink(v.fs, cpath)
+	ret, err := C.glfs_chown(v.fs, cname, cuid(uid), cgid(gid))
+	v.invalidateStat(name)
 	if int(ret) < 0 {
-		return &os.PathError{"unlink", path, err}
+		return &os.PathError{Op: "chown", Path: name, Err: err}
 	}
 	return nil
 }
 
-// Lstat returns an os.FileInfo object describing the named file. It doesn't follow the link if the file is a symlink.
+// Lchown changes the uid, gid of the named file. If the file is a symbolic
+// link, it changes the ids of the link itself.
+// A uid or gid of -1 leaves that id unchanged.
 //
 // Returns an error on failure
-func (v *Volume) Lstat(name string) (os.FileInfo, error) {
+func (v *Volume) Lchown(name string, uid, gid int) error {
+	if err := v.checkMounted("lchown", name); err != nil {
+		return err
+	}
+
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 
-	var stat syscall.Stat_t
-	ret, err := C.glfs_lstat(v.fs, cname, (*C.struct_stat)(unsafe.Pointer(&stat)))
+	ret, err := C.glfs_lchown(v.fs, cname, cuid(uid), cgid(gid))
+	v.invalidateStat(name)
 	if int(ret) < 0 {
-		return nil, err
+		return &os.PathError{Op: "lchown", Path: name, Err: err}
 	}
-	return fileInfoFromStat(&stat, name), nil
+	return nil
 }
 
-// Mkdir creates a new directory with given name and permission bits
+// ChownName is like Chown, but takes the names of the user and group, which
+// are resolved to ids on the client with the os/user package. An empty user
+// or group leaves that id unchanged.
 //
-// Returns an error on failure
-func (v *Volume) Mkdir(name string, perm os.FileMode) error {
-	cname := C.CString(name)
-	defer C.free(unsafe.Pointer(cname))
-
-	ret, err := C.glfs_mkdir(v.fs, cname, C.mode_t(posixMode(perm)))
-
-	if ret != 0 {
+// Returns an error on failure, including when a name cannot be resolved
+func (v *Volume) ChownName(name, username, groupname string) error {
+	uid, gid := -1, -1
+	if username != "" {
+		u, err := user.Lookup(username)
+		if err != nil {
+			return &os.PathError{Op: "chown", Path: name, Err: err}
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return &os.PathError{Op: "chown", Path: name, Err: err}
+		}
+	}
+	if groupname != "" {
+		g, err := user.LookupGroup(groupname)
+		if err != nil {
+			return &os.PathError{Op: "chown", Path: name, Err: err}
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return &os.PathError{Op: "chown", Path: name, Err: err}
+		}
+	}
+	return v.Chown(name, uid, gid)
+}
+
+// ChmodAll changes the mode of root and everything below it to the given
+// mode. Symbolic links are neither followed nor changed.
+// ChmodAll carries on past failures.
+//
+// Returns the first error encountered
+func (v *Volume) ChmodAll(root string, mode os.FileMode) error {
+	var first error
+	v.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type()&os.ModeSymlink == 0 {
+			err = v.Chmod(name, mode)
+		}
+		if first == nil {
+			first = err
+		}
+		return nil
+	})
+	return first
+}
+
+// ChownAll changes the uid, gid of root and everything below it. Symbolic
+// links are not followed, their own ids are changed instead.
+// A uid or gid of -1 leaves that id unchanged. ChownAll carries on past failures.
+//
+// Returns the first error encountered
+func (v *Volume) ChownAll(root string, uid, gid int) error {
+	var first error
+	v.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err == nil {
+			err = v.Lchown(name, uid, gid)
+		}
+		if first == nil {
+			first = err
+		}
+		return nil
+	})
+	return first
+}
+
+// Chtimes changes the mtime of the named file, leaving its atime unchanged
+//
+// Returns an error on failure
+func (v *Volume) Chtimes(name string, mtime time.Time) error {
+	return v.Utimens(name, TimeOmit, mtime)
+}
+
+// Utimens changes the atime and mtime of the named file. Either time may be
+// TimeOmit to leave it unchanged, or TimeNow to set it to the current time.
+//
+// Returns an error on failure
+func (v *Volume) Utimens(name string, atime, mtime time.Time) error {
+	if err := v.checkMounted("utimens", name); err != nil {
+		return err
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	times := timespecs(atime, mtime)
+	ret, err := C.glfs_utimens(v.fs, cname, &times[0])
+	v.invalidateStat(name)
+	if int(ret) < 0 {
+		return &os.PathError{Op: "utimens", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Lutimens is like Utimens, but if the named file is a symbolic link, it
+// changes the times of the link itself.
+//
+// Returns an error on failure
+func (v *Volume) Lutimens(name string, atime, mtime time.Time) error {
+	if err := v.checkMounted("lutimens", name); err != nil {
+		return err
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	times := timespecs(atime, mtime)
+	ret, err := C.glfs_lutimens(v.fs, cname, &times[0])
+	v.invalidateStat(name)
+	if int(ret) < 0 {
+		return &os.PathError{Op: "lutimens", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Create creates a file with given name on the the Volume v.
+// The Volume must be mounted before calling Create.
+// Create is similar to os.Create in its functioning.
+//
+// name is the name of the file to be create.
+//
+// Returns a File object on success and a os.PathError on failure.
+func (v *Volume) Create(name string) (*File, error) {
+	return v.CreateMode(name, 0666)
+}
+
+// CreateMode is like Create, but creates the file with the permission bits
+// perm (before umask) instead of 0666.
+//
+// Returns a File object on success and a os.PathError on failure.
+func (v *Volume) CreateMode(name string, perm os.FileMode) (*File, error) {
+	if err := v.checkMounted("create", name); err != nil {
+		return nil, err
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	cfd, err := C.glfs_creat(v.fs, cname, C.int(os.O_RDWR|os.O_CREATE|os.O_TRUNC), v.createMode(perm))
+	v.invalidateStat(name)
+
+	if cfd == nil {
+		return nil, &os.PathError{"create", name, err}
+	}
+
+	return v.newFile(name, cfd, false), nil
+}
+
+// Unlink attempts to unlink a file a path and returns a non-nil error on failure.
+func (v *Volume) Unlink(path string) error {
+	if err := v.checkMounted("unlink", path); err != nil {
+		return err
+	}
+
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	ret, err := C.glfs_unlink(v.fs, cpath)
+	v.invalidateStat(path)
+	if int(ret) < 0 {
+		return &os.PathError{"unlink", path, err}
+	}
+	return nil
+}
+
+// Lstat returns an os.FileInfo object describing the named file. It doesn't follow the link if the file is a symlink.
+//
+// Returns an *os.PathError on failure, see Stat
+func (v *Volume) Lstat(name string) (os.FileInfo, error) {
+	if err := v.checkMounted("lstat", name); err != nil {
+		return nil, err
+	}
+
+	return withStaleRetry(v, name, func() (os.FileInfo, error) { return v.lstat(name) })
+}
+
+// lstat is Lstat without the ESTALE retry.
+func (v *Volume) lstat(name string) (os.FileInfo, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	var stat syscall.Stat_t
+	ret, err := C.glfs_lstat(v.fs, cname, (*C.struct_stat)(unsafe.Pointer(&stat)))
+	if int(ret) < 0 {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	return fileInfoFromStat(&stat, name), nil
+}
+
+// Chdir changes the current working directory of the Volume, which relative
+// names passed to its operations are resolved against, to the directory
+// name. The working directory is initially the root of the volume.
+//
+// Returns an error on failure
+func (v *Volume) Chdir(name string) error {
+	if err := v.checkMounted("chdir", name); err != nil {
+		return err
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	ret, err := C.glfs_chdir(v.fs, cname)
+	if int(ret) < 0 {
+		return &os.PathError{Op: "chdir", Path: name, Err: err}
+	}
+	v.clearStatCache()
+	return nil
+}
+
+// Getwd returns the current working directory of the Volume as an absolute path
+//
+// Returns an error on failure
+func (v *Volume) Getwd() (string, error) {
+	if err := v.checkMounted("getwd", "."); err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, C.PATH_MAX)
+	cwd, err := C.glfs_getcwd(v.fs, (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf)))
+	if cwd == nil {
+		return "", &os.PathError{Op: "getwd", Path: ".", Err: err}
+	}
+	return C.GoString(cwd), nil
+}
+
+// Realpath returns the absolute path of the named file, with relative names
+// resolved against the working directory and all symbolic links, "." and ".."
+// elements resolved
+//
+// Symbolic links are resolved by gfapi, which gives up on chains of links
+// that are too long or cyclic.
+//
+// Returns an error on failure, wrapping syscall.ELOOP for such links
+func (v *Volume) Realpath(name string) (string, error) {
+	if err := v.checkMounted("realpath", name); err != nil {
+		return "", err
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	buf := make([]byte, C.PATH_MAX)
+	resolved, err := C.glfs_realpath(v.fs, cname, (*C.char)(unsafe.Pointer(&buf[0])))
+	if resolved == nil {
+		return "", &os.PathError{Op: "realpath", Path: name, Err: err}
+	}
+	return C.GoString(resolved), nil
+}
+
+// Readlink returns the destination of the named symbolic link
+//
+// Returns an error on failure
+func (v *Volume) Readlink(name string) (string, error) {
+	if err := v.checkMounted("readlink", name); err != nil {
+		return "", err
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	target, err := readlinkBuffer(func(buf []byte) (int, error) {
+		ret, err := C.glfs_readlink(v.fs, cname, (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf)))
+		return int(ret), err
+	})
+	if err != nil {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return target, nil
+}
+
+// ReadlinksIn returns the destinations of the symbolic links in the
+// directory dir, keyed by the names of the links. Other entries are skipped.
+// Links are recognized by the type readdir reports, and only entries of
+// unknown type are Lstat'd. Links removed while they are being read are left
+// out.
+//
+// Returns an error on failure
+func (v *Volume) ReadlinksIn(dir string) (map[string]string, error) {
+	entries, err := v.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make(map[string]string)
+	for _, d := range entries {
+		typ := d.Type()
+		if typ == os.ModeIrregular {
+			info, err := d.Info()
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			typ = info.Mode().Type()
+		}
+		if typ != os.ModeSymlink {
+			continue
+		}
+
+		target, err := v.Readlink(path.Join(dir, d.Name()))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		targets[d.Name()] = target
+	}
+	return targets, nil
+}
+
+// Symlink creates newname as a symbolic link to oldname
+//
+// Returns an error on failure
+func (v *Volume) Symlink(oldname, newname string) error {
+	if !v.mounted {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrNotMounted}
+	}
+
+	coldname := C.CString(oldname)
+	defer C.free(unsafe.Pointer(coldname))
+
+	cnewname := C.CString(newname)
+	defer C.free(unsafe.Pointer(cnewname))
+
+	ret, err := C.glfs_symlink(v.fs, coldname, cnewname)
+	v.invalidateStat(newname)
+	if int(ret) < 0 {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+// Link creates newname as a hard link to the oldname file
+//
+// Returns an error on failure
+func (v *Volume) Link(oldname, newname string) error {
+	if !v.mounted {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: ErrNotMounted}
+	}
+
+	coldname := C.CString(oldname)
+	defer C.free(unsafe.Pointer(coldname))
+
+	cnewname := C.CString(newname)
+	defer C.free(unsafe.Pointer(cnewname))
+
+	ret, err := C.glfs_link(v.fs, coldname, cnewname)
+	v.invalidateStat(oldname, newname)
+	if int(ret) < 0 {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+// Mknod creates the special or ordinary file name, like syscall.Mknod. mode
+// holds both the file type, such as syscall.S_IFIFO, and the permission
+// bits, less the umask of the Volume, and dev is the device number of a
+// device file.
+//
+// Returns an *os.PathError on failure
+func (v *Volume) Mknod(name string, mode uint32, dev int) error {
+	if err := v.checkMounted("mknod", name); err != nil {
+		return err
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	ret, err := C.glfs_mknod(v.fs, cname, C.mode_t(mode&^v.umask), C.dev_t(dev))
+	v.invalidateStat(name)
+
+	if ret != 0 {
+		return &os.PathError{Op: "mknod", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Mkdir creates a new directory with given name and permission bits
+//
+// Returns an *os.PathError on failure, which wraps fs.ErrExist if name
+// already exists
+func (v *Volume) Mkdir(name string, perm os.FileMode) error {
+	if err := v.checkMounted("mkdir", name); err != nil {
+		return err
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	ret, err := C.glfs_mkdir(v.fs, cname, v.createMode(perm))
+	v.invalidateStat(name)
+
+	if ret != 0 {
 		return &os.PathError{"mkdir", name, err}
 	}
 	return nil
 }
 
+// MkdirIfNotExists creates a new directory with given name and permission
+// bits, unless a directory of that name already exists, and reports whether
+// it created the directory.
+//
+// Returns an error on failure, which wraps fs.ErrExist if name exists but is
+// not a directory
+func (v *Volume) MkdirIfNotExists(name string, perm os.FileMode) (created bool, err error) {
+	err = v.Mkdir(name, perm)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, fs.ErrExist) {
+		return false, err
+	}
+
+	if info, serr := v.Stat(name); serr != nil || !info.IsDir() {
+		return false, err
+	}
+	return false, nil
+}
+
 // Removes an existing directory
 //
 // Returns error on failure
 func (v *Volume) Rmdir(path string) error {
+	if err := v.checkMounted("rmdir", path); err != nil {
+		return err
+	}
 
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
 
 	ret, err := C.glfs_rmdir(v.fs, cpath)
+	v.invalidateStat(path)
 
 	if ret != 0 {
 		return &os.PathError{"rmdir", path, err}
@@ -284,10 +1151,43 @@ func (v *Volume) Rmdir(path string) error {
 	return nil
 }
 
+// Remove removes the named file or empty directory, like os.Remove.
+//
+// Returns an *os.PathError on failure, wrapping syscall.ENOTEMPTY if name is
+// a directory that is not empty
+//
+// Based on the implementation of os.Remove in the Go source
+func (v *Volume) Remove(name string) error {
+	err := v.Unlink(name)
+	if err == nil {
+		return nil
+	}
+	err1 := v.Rmdir(name)
+	if err1 == nil {
+		return nil
+	}
+
+	// Both failed: figure out which error to return.
+	// Unlink fails with EISDIR or EPERM for a directory, in which case the
+	// error of Rmdir tells why it cannot be removed. Rmdir fails with ENOTDIR
+	// for anything else, in which case the error of Unlink does.
+	if !errors.Is(err1, syscall.ENOTDIR) {
+		err = err1
+	}
+	var perr *os.PathError
+	if errors.As(err, &perr) {
+		err = perr.Err
+	}
+	return &os.PathError{Op: "remove", Path: name, Err: err}
+}
+
 // MkdirAll creates a directory named path, along with any necessary parents,
 // and returns nil, or else returns an error.
 // The permission bits perm are used for all directories that MkdirAll creates.
 // If path is already a directory, MkdirAll does nothing and returns nil.
+// MkdirAll is safe to call concurrently, including from other clients, on
+// overlapping paths: a directory created by someone else in the meantime,
+// at any level, counts as success.
 func (v *Volume) MkdirAll(path string, perm os.FileMode) error {
 	// Fast path: if we can tell whether path is a directory or file, stop with success or error.
 	dir, err := v.Stat(path)
@@ -298,124 +1198,939 @@ func (v *Volume) MkdirAll(path string, perm os.FileMode) error {
 		return &os.PathError{"mkdir", path, syscall.ENOTDIR}
 	}
 
-	// Slow path: make sure parent exists and then call Mkdir for path.
-	i := len(path)
-	for i > 0 && os.IsPathSeparator(path[i-1]) { // Skip trailing path separator.
-		i--
+	// Slow path: make sure parent exists and then call Mkdir for path.
+	i := len(path)
+	for i > 0 && os.IsPathSeparator(path[i-1]) { // Skip trailing path separator.
+		i--
+	}
+
+	j := i
+	for j > 0 && !os.IsPathSeparator(path[j-1]) { // Scan backward over element.
+		j--
+	}
+
+	if j > 1 {
+		// Create parent
+		err = v.MkdirAll(path[0:j-1], perm)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Parent now exists; invoke Mkdir and use its result.
+	err = v.Mkdir(path, perm)
+	if err != nil {
+		// Handle arguments like "foo/.", and concurrent creators which made
+		// the directory since the Stat above, by double-checking that
+		// directory doesn't exist.
+		dir, err1 := v.Lstat(path)
+		if err1 == nil && dir.IsDir() {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// MkdirAllMany calls MkdirAll for each of paths with the permission bits perm.
+// It carries on past failures and returns one error per path, in the same
+// order as paths, which is nil for each path that was created or already existed.
+func (v *Volume) MkdirAllMany(paths []string, perm os.FileMode) []error {
+	errs := make([]error, len(paths))
+	for i, path := range paths {
+		errs[i] = v.MkdirAll(path, perm)
+	}
+	return errs
+}
+
+// RemoveAll removes path and any children it con
+
+// Open opens the named file on the the Volume v.
+// The Volume must be mounted before calling Open.
+// Open is similar to os.Open in its functioning.
+//
+// name is the name of the file to be open.
+//
+// Returns a File object on success and a os.PathError on failure.
+func (v *Volume) Open(name string) (*File, error) {
+	if err := v.checkMounted("open", name); err != nil {
+		return nil, err
+	}
+
+	return withStaleRetry(v, name, func() (*File, error) { return openFile(v, name) })
+}
+
+// openFile opens a file for Open, and can be replaced in tests.
+var openFile = (*Volume).open
+
+// open is Open without the ESTALE retry.
+func (v *Volume) open(name string) (*File, error) {
+	var isDir bool
+
+	if stat, err := v.Stat(name); err != nil {
+		return nil, v.openStatError(name, err)
+	} else {
+		isDir = stat.IsDir()
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	var cfd *C.glfs_fd_t
+	var err error
+	if isDir {
+		cfd, err = C.glfs_opendir(v.fs, cname)
+	} else {
+		cfd, err = C.glfs_open(v.fs, cname, C.int(os.O_RDONLY))
+	}
+	if cfd == nil {
+		return nil, &os.PathError{"open", name, err}
+	}
+
+	return v.newFile(name, cfd, isDir), nil
+}
+
+// openStatError returns the error of Open for the error err of the Stat of
+// name, telling a dangling symbolic link apart from a missing file.
+func (v *Volume) openStatError(name string, err error) error {
+	var perr *os.PathError
+	if errors.As(err, &perr) {
+		err = perr.Err
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		if target, lerr := v.Readlink(name); lerr == nil {
+			err = fmt.Errorf("dangling symbolic link to %q: %w", target, err)
+		}
+	}
+	return &os.PathError{Op: "open", Path: name, Err: err}
+}
+
+// OpenReadOnly opens the named regular file for reading, like Open, but
+// without the Stat Open makes to tell files from directories. It saves a
+// round trip when the caller knows name is not a directory, which should be
+// opened with Open or OpenDir instead.
+//
+// Returns a File object on success and a os.PathError on failure.
+func (v *Volume) OpenReadOnly(name string) (*File, error) {
+	return v.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// O_CHMOD is an OpenFile flag specific to this package, which makes OpenFile
+// set the mode of the file to perm, whether or not the file is created.
+// It is never passed on to gfapi, and uses a bit no open flag does. It cannot
+// be combined with O_PATH or with O_DIRECTORY, except as part of O_TMPFILE.
+const O_CHMOD = 1 << 30
+
+// O_TMPFILE makes OpenFile create an unnamed regular file in the directory
+// name, which is removed when closed unless it is given a name with
+// File.Materialize first. It must be combined with O_WRONLY or O_RDWR.
+// Open fails with syscall.ENOTSUP if the volume does not support it.
+const O_TMPFILE = 020000000 | syscall.O_DIRECTORY
+
+// O_PATH makes OpenFile return a File which only serves as a handle on the
+// file or directory name: it can be passed to Stat, Chdir and the *at
+// operations, such as Statat and Openat, but reads, writes and Truncate fail
+// with syscall.EBADF. It may only be combined with O_DIRECTORY, which makes
+// OpenFile fail with syscall.ENOTDIR unless name is a directory.
+//
+// gfapi has no O_PATH of its own, so the handle is an fd opened read-only,
+// and unlike on Linux opening it still requires read permission where the
+// volume enforces permissions.
+const O_PATH = 010000000
+
+// OpenFile opens the named file on the the Volume v.
+// The Volume must be mounted before calling OpenFile.
+// OpenFile is similar to os.OpenFile in its functioning.
+//
+// name is the name of the file to be open.
+// flags is the access mode of the file.
+// perm is the permissions for the opened file.
+//
+// Returns a File object on success and a os.PathError on failure.
+//
+// Like os.OpenFile, by default perm is only used, less the umask of the
+// Volume, see Umask, when O_CREATE creates the file, and is ignored for an
+// existing file. Only the permission bits of perm are used, and O_CREATE
+// always creates a regular file. With the O_CHMOD flag, the mode of the file
+// is set to exactly perm after opening it, regardless of the umask.
+// NOTE: It is better to use Open, Create etc. instead of using OpenFile directly
+func (v *Volume) OpenFile(name string, flags int, perm os.FileMode) (*File, error) {
+	if err := v.checkMounted("open", name); err != nil {
+		return nil, err
+	}
+
+	if err := checkOpenFlags(flags); err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	if flags&O_PATH != 0 {
+		return withStaleRetry(v, name, func() (*File, error) { return v.openPath(name, flags) })
+	}
+	// glfs_open refuses directories, so they are opened as by OpenDir.
+	if flags&syscall.O_DIRECTORY != 0 && flags&O_TMPFILE != O_TMPFILE {
+		if flags&syscall.O_ACCMODE != os.O_RDONLY {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+		}
+		return withStaleRetry(v, name, func() (*File, error) { return v.OpenDir(name) })
+	}
+
+	// An exclusive create is not retried, as the failed attempt may have
+	// created the file.
+	if flags&os.O_EXCL != 0 {
+		return v.openFlags(name, flags, perm)
+	}
+	return withStaleRetry(v, name, func() (*File, error) { return v.openFlags(name, flags, perm) })
+}
+
+// openFlags is OpenFile without the flag checks and the ESTALE retry.
+func (v *Volume) openFlags(name string, flags int, perm os.FileMode) (*File, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	chmod := flags&O_CHMOD != 0
+	flags &^= O_CHMOD
+
+	// glfs_open takes no mode, so that of a temporary file is set once open.
+	tmpfile := flags&O_TMPFILE == O_TMPFILE
+	if tmpfile && !chmod {
+		chmod = true
+		perm &^= os.FileMode(v.umask)
+	}
+
+	var cfd *C.glfs_fd_t
+	var err error
+	if (os.O_CREATE & flags) == os.O_CREATE {
+		cfd, err = C.glfs_creat(v.fs, cname, C.int(flags), v.createMode(perm))
+	} else {
+		cfd, err = C.glfs_open(v.fs, cname, C.int(flags))
+	}
+	if flags&(os.O_CREATE|os.O_TRUNC) != 0 {
+		v.invalidateStat(name)
+	}
+
+	if cfd == nil {
+		if tmpfile && (err == syscall.EISDIR || err == syscall.EINVAL || err == syscall.EOPNOTSUPP) {
+			err = syscall.ENOTSUP
+		}
+		return nil, &os.PathError{"open", name, err}
+	}
+
+	f := v.newFile(name, cfd, false)
+	if chmod {
+		if err := f.Chmod(perm); err != nil {
+			f.Close()
+			return nil, &os.PathError{Op: "chmod", Path: name, Err: err}
+		}
+	}
+	return f, nil
+}
+
+// openPath opens name for OpenFile with O_PATH, as a directory if it is one.
+func (v *Volume) openPath(name string, flags int) (*File, error) {
+	f, err := v.open(name)
+	if err != nil {
+		return nil, err
+	}
+	if flags&syscall.O_DIRECTORY != 0 && !f.isDir {
+		f.Close()
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.ENOTDIR}
+	}
+	f.pathOnly = true
+	return f, nil
+}
+
+// checkOpenFlags() returns an error wrapping ErrInvalidFlags if flags combine
+// both write-only and read-write access, O_RDONLY with a flag that needs
+// write access, O_TMPFILE or O_DIRECTORY with O_CREATE, O_CHMOD with
+// O_DIRECTORY, or O_PATH with anything but O_DIRECTORY
+func checkOpenFlags(flags int) error {
+	if flags&O_PATH != 0 && flags&^(O_PATH|syscall.O_DIRECTORY) != 0 {
+		return fmt.Errorf("%w: O_PATH can only be combined with O_DIRECTORY", ErrInvalidFlags)
+	}
+	if flags&O_CHMOD != 0 && flags&syscall.O_DIRECTORY != 0 && flags&O_TMPFILE != O_TMPFILE {
+		return fmt.Errorf("%w: O_CHMOD cannot be combined with O_DIRECTORY", ErrInvalidFlags)
+	}
+	if flags&O_TMPFILE == O_TMPFILE && flags&os.O_CREATE != 0 {
+		return fmt.Errorf("%w: O_TMPFILE and O_CREATE are mutually exclusive", ErrInvalidFlags)
+	}
+	if flags&syscall.O_DIRECTORY != 0 && flags&os.O_CREATE != 0 {
+		return fmt.Errorf("%w: O_CREATE cannot create a directory, use Mkdir", ErrInvalidFlags)
+	}
+
+	switch flags & syscall.O_ACCMODE {
+	case os.O_RDONLY:
+		if flags&O_TMPFILE == O_TMPFILE {
+			return fmt.Errorf("%w: O_TMPFILE requires write access", ErrInvalidFlags)
+		}
+		if flags&os.O_TRUNC != 0 {
+			return fmt.Errorf("%w: O_TRUNC requires write access", ErrInvalidFlags)
+		}
+		if flags&os.O_APPEND != 0 {
+			return fmt.Errorf("%w: O_APPEND requires write access", ErrInvalidFlags)
+		}
+	case os.O_WRONLY, os.O_RDWR:
+	default:
+		return fmt.Errorf("%w: O_WRONLY and O_RDWR are mutually exclusive", ErrInvalidFlags)
+	}
+	return nil
+}
+
+// OpenFileContext is like OpenFile, but stops waiting for the open to
+// complete once ctx is done and returns ctx.Err().
+// The open itself cannot be interrupted. If it succeeds after ctx is done,
+// the File is closed again in the background.
+func (v *Volume) OpenFileContext(ctx context.Context, name string, flags int, perm os.FileMode) (*File, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		f   *File
+		err error
+	}
+	done := make(chan result)
+
+	v.ops.begin()
+	go func() {
+		defer v.ops.end()
+
+		f, err := v.OpenFile(name, flags, perm)
+		select {
+		case done <- result{f, err}:
+		case <-ctx.Done():
+			if err == nil {
+				f.Close()
+			}
+		}
+	}()
+
+	select {
+	case r := <-done:
+		return r.f, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ReadFile reads the named file and returns its contents, like os.ReadFile.
+//
+// Returns an error on failure, but not io.EOF
+func (v *Volume) ReadFile(name string) ([]byte, error) {
+	f, err := v.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return f.ReadAll()
+}
+
+// FileChecksum streams the named file through h, see File.Checksum, and
+// returns the digest, h.Sum(nil). h is not reset first.
+//
+// Returns an error on failure
+func (v *Volume) FileChecksum(name string, h hash.Hash) ([]byte, error) {
+	f, err := v.OpenReadOnly(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if _, err := f.Checksum(h); err != nil {
+		return nil, &os.PathError{Op: "read", Path: name, Err: err}
+	}
+	return h.Sum(nil), nil
+}
+
+// CopyTo streams the named file to w through a pooled buffer, see
+// SetIOBufferSize, and closes it once done, sparing the caller the File.
+//
+// Returns the number of bytes copied and an error if any, but not io.EOF.
+// Errors reading the file are *os.PathError, those of w are returned as is.
+func (v *Volume) CopyTo(w io.Writer, name string) (int64, error) {
+	f, err := v.OpenReadOnly(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return v.ioBuffers().copy(w, f)
+}
+
+// CopyFrom creates the named file with the permission bits perm (before
+// umask), or truncates it if it exists, and streams r into it through a
+// pooled buffer, see SetIOBufferSize, until io.EOF. The file is synced and
+// closed once done. This is the counterpart of CopyTo.
+//
+// Returns the number of bytes written and an error if any. An error reading
+// r is returned as is, along with the number of bytes written before it.
+func (v *Volume) CopyFrom(name string, r io.Reader, perm os.FileMode) (int64, error) {
+	f, err := v.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return 0, err
+	}
+
+	// Hide any WriteTo of r, such as that of bytes.Reader, which would
+	// bypass the buffer and hand the whole data to a single Write.
+	n, err := v.ioBuffers().copy(f, struct{ io.Reader }{r})
+	if err != nil {
+		f.Close()
+		return n, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return n, &os.PathError{Op: "fsync", Path: name, Err: err}
+	}
+	return n, f.Close()
+}
+
+// SectionReader is an io.SectionReader over a File opened by OpenSection,
+// which it closes on Close.
+type SectionReader struct {
+	*io.SectionReader
+	f *File
+}
+
+// Close closes the File the SectionReader reads from.
+//
+// Returns an error on failure
+func (sr *SectionReader) Close() error {
+	return sr.f.Close()
+}
+
+// OpenSection opens the named file for reading and returns a SectionReader
+// over the length bytes starting at off, such as for serving a range request.
+// The range is clamped to the size of the file at the time of the call, so
+// it is empty if off is at or past the end.
+//
+// The reader reads through a File of its own, which the caller must release
+// with Close.
+//
+// Returns an error on failure
+func (v *Volume) OpenSection(name string, off, length int64) (*SectionReader, error) {
+	if off < 0 {
+		return nil, &os.PathError{Op: "opensection", Path: name, Err: ErrNegativeOffset}
+	}
+	if length < 0 {
+		return nil, &os.PathError{Op: "opensection", Path: name, Err: ErrNegativeSize}
+	}
+
+	f, err := v.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	size := info.Size()
+	off = min(off, size)
+	length = min(length, size-off)
+
+	return &SectionReader{SectionReader: io.NewSectionReader(f, off, length), f: f}, nil
+}
+
+// WriteFileWithXattrs writes data to the named file along with the extended
+// attributes xattrs, and sets its permission bits to exactly perm, replacing
+// the file if it exists. The file is written, synced and given its
+// attributes under a temporary name in the same directory, then renamed into
+// place, so that readers see either the old file or the new one complete
+// with its attributes.
+//
+// Returns an error on failure, in which case the temporary file is removed
+func (v *Volume) WriteFileWithXattrs(name string, data []byte, perm os.FileMode, xattrs map[string][]byte) error {
+	tmp := path.Join(path.Dir(name), "."+path.Base(name)+".tmp"+strconv.FormatUint(rand.Uint64(), 36))
+	f, err := v.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL|O_CHMOD, perm)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileWithXattrs(f, data, xattrs); err != nil {
+		f.Close()
+		v.Unlink(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		v.Unlink(tmp)
+		return err
+	}
+	if err := v.Rename(tmp, name); err != nil {
+		v.Unlink(tmp)
+		return &os.LinkError{Op: "rename", Old: tmp, New: name, Err: err}
+	}
+	return nil
+}
+
+// writeFileWithXattrs writes data and xattrs to f, and syncs it.
+func writeFileWithXattrs(f *File, data []byte, xattrs map[string][]byte) error {
+	if _, err := f.Write(data); err != nil {
+		return &os.PathError{Op: "write", Path: f.name, Err: err}
+	}
+
+	names := make([]string, 0, len(xattrs))
+	for attr := range xattrs {
+		names = append(names, attr)
+	}
+	sort.Strings(names)
+	for _, attr := range names {
+		if err := f.Setxattr(attr, xattrs[attr], 0); err != nil {
+			return &os.PathError{Op: "setxattr", Path: f.name, Err: fmt.Errorf("%s: %w", attr, xattrError(attr, err))}
+		}
+	}
+
+	if err := f.Sync(); err != nil {
+		return &os.PathError{Op: "fsync", Path: f.name, Err: err}
+	}
+	return nil
+}
+
+// CopyFile copies the contents of the file src to the file dst, which is
+// created with the permission bits of src if needed, and truncated otherwise.
+// The data is copied with CopyRange.
+//
+// Returns the number of bytes copied and an error if any
+func (v *Volume) CopyFile(src, dst string) (int64, error) {
+	in, err := v.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	out, err := v.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := v.CopyRange(out, 0, in, 0, info.Size())
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// Pwritev writes the buffers in bufs in turn to the named file starting from
+// offset off, see File.Pwritev. The file is opened for the write, and created
+// with the permission bits perm (before umask) if needed.
+//
+// Returns number of bytes written and an error if any, which is
+// io.ErrShortWrite if not all of the buffers were written
+func (v *Volume) Pwritev(name string, bufs [][]byte, off int64, perm os.FileMode) (int, error) {
+	f, err := v.OpenFile(name, os.O_WRONLY|os.O_CREATE, perm)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := f.Pwritev(bufs, off)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return n, &os.PathError{Op: "pwritev", Path: name, Err: err}
+	}
+
+	total := 0
+	for _, b := range bufs {
+		total += len(b)
+	}
+	if n < total {
+		return n, &os.PathError{Op: "pwritev", Path: name, Err: io.ErrShortWrite}
+	}
+	return n, nil
+}
+
+// Preadv reads into the buffers in bufs in turn from the named file starting
+// from offset off, see File.Preadv.
+//
+// Returns number of bytes read and an error if any
+func (v *Volume) Preadv(name string, bufs [][]byte, off int64) (int, error) {
+	f, err := v.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n, err := f.Preadv(bufs, off)
+	if err != nil {
+		return n, &os.PathError{Op: "preadv", Path: name, Err: err}
+	}
+	return n, nil
+}
+
+// defaultZeroThreshold is the block size of WriteSparse if none is given.
+const defaultZeroThreshold = 4 << 10
+
+// WriteSparse writes the data read from r until EOF to the named file, which
+// is created if needed and truncated otherwise, leaving holes instead of
+// writing zeros. The data is checked for zeros in blocks of zeroThreshold
+// bytes, or 4 KiB if zeroThreshold <= 0, and blocks of zeros are skipped, so
+// that runs of at least twice zeroThreshold zeros are sure to leave a hole.
+// Whether smaller holes are kept depends on the block size of the bricks.
+//
+// Returns an error on failure
+func (v *Volume) WriteSparse(name string, r io.Reader, zeroThreshold int) error {
+	if zeroThreshold <= 0 {
+		zeroThreshold = defaultZeroThreshold
+	}
+
+	f, err := v.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf := make([]byte, max(int(v.ioBuffers().size.Load())/zeroThreshold, 1)*zeroThreshold)
+	var off int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		// Write each span of consecutive blocks with data at once.
+		data := buf[:n]
+		start := -1
+		for i := 0; i < len(data); i += zeroThreshold {
+			block := data[i:min(i+zeroThreshold, len(data))]
+			if !isZero(block) {
+				if start < 0 {
+					start = i
+				}
+				continue
+			}
+			if start >= 0 {
+				if _, err := f.WriteAt(data[start:i], off+int64(start)); err != nil {
+					return err
+				}
+				start = -1
+			}
+		}
+		if start >= 0 {
+			if _, err := f.WriteAt(data[start:], off+int64(start)); err != nil {
+				return err
+			}
+		}
+		off += int64(n)
+
+		if n < len(buf) {
+			break
+		}
+	}
+
+	// Extend the file over a trailing hole.
+	if err := f.Truncate(off); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// isZero reports whether b holds only zeros.
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// copyRangeChunk is the most CopyRange asks glfs_copy_file_range to copy at once.
+const copyRangeChunk = 1 << 30
+
+// CopyRange copies length bytes from src starting at offset srcOff to dst
+// starting at offset dstOff, without changing the offsets of either file.
+// It stops early, without an error, at the end of src.
+//
+// If both files were opened from v and the loaded libgfapi has
+// copy_file_range (see FeatureCopyFileRange), the bricks copy the data without
+// it passing through the client. Otherwise, or if the bricks cannot copy it,
+// it is read and written back through a pooled buffer, see SetIOBufferSize.
+//
+// Returns the number of bytes copied and an error if any
+func (v *Volume) CopyRange(dst *File, dstOff int64, src *File, srcOff, length int64) (int64, error) {
+	if srcOff < 0 || dstOff < 0 {
+		return 0, ErrNegativeOffset
+	}
+	if length < 0 {
+		return 0, ErrNegativeSize
+	}
+	if src.glfs.fd == nil || dst.glfs.fd == nil {
+		return 0, &os.LinkError{Op: "copy_file_range", Old: src.name, New: dst.name, Err: os.ErrClosed}
+	}
+	defer dst.invalidateStat()
+
+	var copied int64
+	if fn := featureFunc(FeatureCopyFileRange); fn != nil && src.vol == v && dst.vol == v {
+		for copied < length {
+			offIn := C.off_t(srcOff + copied)
+			offOut := C.off_t(dstOff + copied)
+			n, err := C.call_copy_file_range(fn, src.glfs.fd, &offIn, dst.glfs.fd, &offOut,
+				C.size_t(min(length-copied, copyRangeChunk)))
+			if n < 0 {
+				if err == syscall.EXDEV || err == syscall.ENOSYS || err == syscall.EOPNOTSUPP {
+					break
+				}
+				return copied, &os.LinkError{Op: "copy_file_range", Old: src.name, New: dst.name, Err: err}
+			}
+			if n == 0 {
+				return copied, nil
+			}
+			copied += int64(n)
+		}
+		if copied == length {
+			return copied, nil
+		}
+	}
+
+	n, err := v.ioBuffers().copy(io.NewOffsetWriter(dst, dstOff+copied), io.NewSectionReader(src, srcOff+copied, length-copied))
+	return copied + n, err
+}
+
+// Preallocate makes sure size bytes of disk space are allocated to the named
+// file, creating it if needed, so that a subsequent write of up to size bytes
+// cannot run out of space. The file is extended to size if it is smaller, and
+// the allocation is synced before Preallocate returns.
+//
+// Returns an error on failure
+func (v *Volume) Preallocate(name string, size int64) error {
+	if size < 0 {
+		return &os.PathError{Op: "fallocate", Path: name, Err: ErrNegativeSize}
+	}
+
+	f, err := v.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+
+	if size > 0 {
+		if err := f.Fallocate(0, 0, size); err != nil {
+			f.Close()
+			return &os.PathError{Op: "fallocate", Path: name, Err: err}
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return &os.PathError{Op: "fsync", Path: name, Err: err}
+	}
+	return f.Close()
+}
+
+// OpenDir opens the named directory for reading its entries. Like open with
+// O_DIRECTORY, anything but a directory is refused up front, so a file is
+// never mistaken for an empty directory by Readdir. Symbolic links are
+// followed. OpenFile with O_DIRECTORY opens directories the same way.
+//
+// Returns an *os.PathError on failure, wrapping syscall.ENOTDIR if name is
+// not a directory
+func (v *Volume) OpenDir(name string) (*File, error) {
+	if err := v.checkMounted("open", name); err != nil {
+		return nil, err
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	cfd, err := C.glfs_opendir(v.fs, cname)
+	if cfd == nil {
+		return nil, &os.PathError{"open", name, err}
+	}
+
+	return v.newFile(name, cfd, true), nil
+}
+
+// ReadDir reads the named directory and returns all its entries sorted by
+// name, like os.ReadDir. If reading the directory fails part way, the
+// entries read before the error are returned along with it.
+//
+// Returns an error on failure
+func (v *Volume) ReadDir(name string) ([]fs.DirEntry, error) {
+	d, err := v.OpenDir(name)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	entries, err := d.ReadDir(-1)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, err
+}
+
+// ReadDirNames reads the named directory and returns the names of all its
+// entries sorted, leaving out "." and "..".
+//
+// Returns an error on failure
+func (v *Volume) ReadDirNames(name string) ([]string, error) {
+	return v.readDirNames(name, false)
+}
+
+// ReadDirNamesWithDots is like ReadDirNames, but keeps "." and "..".
+func (v *Volume) ReadDirNamesWithDots(name string) ([]string, error) {
+	return v.readDirNames(name, true)
+}
+
+func (v *Volume) readDirNames(name string, dots bool) ([]string, error) {
+	d, err := v.OpenDir(name)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	names, err := d.Readdirnames(0)
+	if !dots {
+		names = slices.DeleteFunc(names, func(n string) bool { return n == "." || n == ".." })
 	}
+	sort.Strings(names)
+	return names, err
+}
 
-	j := i
-	for j > 0 && !os.IsPathSeparator(path[j-1]) { // Scan backward over element.
-		j--
+// DirEntryCount returns the number of entries of the named directory, not
+// counting "." and "..", e.g. to size a progress bar before listing it.
+// The entries are counted with a plain readdir, without a stat per entry.
+// The st_nlink of a directory would be cheaper, but it only counts the
+// subdirectories, and not at all on some bricks.
+// The count is exact as of reading, but entries may come and go right after.
+//
+// Returns an error on failure
+func (v *Volume) DirEntryCount(name string) (int, error) {
+	d, err := v.OpenDir(name)
+	if err != nil {
+		return 0, err
 	}
+	defer d.Close()
 
-	if j > 1 {
-		// Create parent
-		err = v.MkdirAll(path[0:j-1], perm)
+	n := 0
+	for {
+		entry, _, err := d.glfs.readdirType()
 		if err != nil {
-			return err
+			return 0, &os.PathError{Op: "readdir", Path: name, Err: err}
 		}
-	}
-
-	// Parent now exists; invoke Mkdir and use its result.
-	err = v.Mkdir(path, perm)
-	if err != nil {
-		// Handle arguments like "foo/." by
-		// double-checking that directory doesn't exist.
-		dir, err1 := v.Lstat(path)
-		if err1 == nil && dir.IsDir() {
-			return nil
+		if entry == "" {
+			return n, nil
+		}
+		if entry != "." && entry != ".." {
+			n++
 		}
-		return err
 	}
-
-	return nil
 }
 
-// RemoveAll removes path and any children it con
-
-// Open opens the named file on the the Volume v.
-// The Volume must be mounted before calling Open.
-// Open is similar to os.Open in its functioning.
-//
-// name is the name of the file to be open.
+// ReadDirFiltered reads the named directory and returns the os.FileInfo of
+// the entries keep returns true for, sorted by name, leaving out "." and "..".
+// The information comes with the entries from readdirplus, so keep can look
+// at any of it, such as Mode().IsDir(), without a stat per entry.
 //
-// Returns a File object on success and a os.PathError on failure.
-func (v *Volume) Open(name string) (*File, error) {
-	var isDir bool
-
-	if stat, err := v.Stat(name); err != nil {
-		return nil, &os.PathError{"open", name, err}
-	} else {
-		isDir = stat.IsDir()
+// Returns an error on failure
+func (v *Volume) ReadDirFiltered(name string, keep func(os.FileInfo) bool) ([]os.FileInfo, error) {
+	d, err := v.OpenDir(name)
+	if err != nil {
+		return nil, err
 	}
-	cname := C.CString(name)
-	defer C.free(unsafe.Pointer(cname))
+	defer d.Close()
 
-	var cfd *C.glfs_fd_t
-	var err error
-	if isDir {
-		cfd, err = C.glfs_opendir(v.fs, cname)
-	} else {
-		cfd, err = C.glfs_open(v.fs, cname, C.int(os.O_RDONLY))
-	}
+	infos, err := d.Readdir(0)
 	if err != nil {
-		return nil, &os.PathError{"open", name, fmt.Errorf("glfs_open: %v", err)}
-	}
-	if cfd == nil {
-		return nil, &os.PathError{"open", name, err}
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
 	}
-
-	return NewFile(name, &Glfs{cfd}, isDir), nil
+	infos = slices.DeleteFunc(infos, func(info os.FileInfo) bool {
+		return info.Name() == "." || info.Name() == ".." || !keep(info)
+	})
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
 }
 
-// OpenFile opens the named file on the the Volume v.
-// The Volume must be mounted before calling OpenFile.
-// OpenFile is similar to os.OpenFile in its functioning.
-//
-// name is the name of the file to be open.
-// flags is the access mode of the file.
-// perm is the permissions for the opened file.
+// ListDir returns a page of up to limit entries of the named directory,
+// leaving out "." and "..", along with the token for the next page, which is
+// empty once the directory has been read to the end. An empty pageToken
+// starts from the first entry, and a limit <= 0 returns all the remaining
+// entries.
 //
-// Returns a File object on success and a os.PathError on failure.
+// The token is an opaque position in the directory from telldir, so no fd
+// is kept open between pages. Entries are returned in directory order, not
+// sorted, and entries added or removed between pages may be missed.
 //
-// BUG : perm is not used for opening the file.
-// NOTE: It is better to use Open, Create etc. instead of using OpenFile directly
-func (v *Volume) OpenFile(name string, flags int, perm os.FileMode) (*File, error) {
-	cname := C.CString(name)
-	defer C.free(unsafe.Pointer(cname))
+// Returns an error on failure, wrapping syscall.EINVAL if pageToken is malformed
+func (v *Volume) ListDir(name, pageToken string, limit int) (entries []os.FileInfo, nextToken string, err error) {
+	d, err := v.OpenDir(name)
+	if err != nil {
+		return nil, "", err
+	}
+	defer d.Close()
 
-	var cfd *C.glfs_fd_t
-	var err error
-	if (os.O_CREATE & flags) == os.O_CREATE {
-		cfd, err = C.glfs_creat(v.fs, cname, C.int(flags), C.mode_t(posixMode(perm)))
-	} else {
-		cfd, err = C.glfs_open(v.fs, cname, C.int(flags))
+	if pageToken != "" {
+		off, err := strconv.ParseInt(pageToken, 16, 64)
+		if err != nil || off < 0 {
+			return nil, "", &os.PathError{Op: "listdir", Path: name, Err: fmt.Errorf("invalid page token %q: %w", pageToken, syscall.EINVAL)}
+		}
+		d.Seekdir(off)
 	}
 
-	if cfd == nil {
-		return nil, &os.PathError{"open", name, err}
+	for {
+		// The position before each entry, to resume from it on the next page.
+		off, err := d.Telldir()
+		if err != nil {
+			return nil, "", err
+		}
+
+		infos, err := d.Readdir(1)
+		if err != nil {
+			return nil, "", &os.PathError{Op: "readdir", Path: name, Err: err}
+		}
+		if len(infos) == 0 {
+			return entries, "", nil
+		}
+		if infos[0].Name() == "." || infos[0].Name() == ".." {
+			continue
+		}
+		if limit > 0 && len(entries) == limit {
+			return entries, strconv.FormatInt(off, 16), nil
+		}
+		entries = append(entries, infos[0])
 	}
+}
 
-	return NewFile(name, &Glfs{cfd}, false), nil
+// newFile returns a File for the fd cfd opened on the Volume v.
+func (v *Volume) newFile(name string, cfd *C.glfs_fd_t, isDir bool) *File {
+	f := NewFile(name, &Glfs{cfd}, isDir)
+	f.vol = v
+	return f
 }
 
-func (v *Volume) OpenDir(name string) (*File, error) {
-	cname := C.CString(name)
-	defer C.free(unsafe.Pointer(cname))
+// Stat returns an os.FileInfo object describing the named file.
+// The result may come from the stat cache, see EnableStatCache.
+//
+// Returns an *os.PathError on failure. Its Err is the syscall.Errno gfapi
+// failed with, so errors.Is(err, fs.ErrNotExist) holds for ENOENT and
+// errors.Is(err, fs.ErrPermission) for EACCES and EPERM.
+func (v *Volume) Stat(name string) (os.FileInfo, error) {
+	if err := v.checkMounted("stat", name); err != nil {
+		return nil, err
+	}
+	if v.statCache != nil {
+		return v.statCache.stat(name)
+	}
+	return v.stat(name)
+}
 
-	cfd, err := C.glfs_opendir(v.fs, cname)
-	if cfd == nil {
-		return nil, &os.PathError{"open", name, err}
+// stat is Stat bypassing the stat cache.
+func (v *Volume) stat(name string) (os.FileInfo, error) {
+	if err := v.checkMounted("stat", name); err != nil {
+		return nil, err
 	}
 
-	return NewFile(name, &Glfs{cfd}, true), nil
+	return withStaleRetry(v, name, func() (os.FileInfo, error) { return v.statOnce(name) })
 }
 
-// Stat returns an os.FileInfo object describing the named file
-//
-// Returns an error on failure
-func (v *Volume) Stat(name string) (os.FileInfo, error) {
+// statOnce is stat without the ESTALE retry.
+func (v *Volume) statOnce(name string) (os.FileInfo, error) {
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 
@@ -427,28 +2142,54 @@ func (v *Volume) Stat(name string) (os.FileInfo, error) {
 	return fileInfoFromStat(&stat, name), nil
 }
 
-// Truncate changes the size of the named file
+// Truncate changes the size of the named file. Growing the file does not
+// allocate the new space; the extension is a hole which reads back as zeros,
+// see TruncateFill.
 //
-// # Returns an error on failure
+// The file is truncated through an fd, as glfs_truncate is missing from older
+// libgfapi releases.
 //
-// TODO: gfapi currently (20131120) has not implement glfs_truncate.
-//
-//	Once it has been implemented, renable the commented out code
-//	or write own function to implement the functionality of glfs_truncate
+// Returns an error on failure
 func (v *Volume) Truncate(name string, size int64) error {
-	// cname := C.CString(name)
-	// defer C.free(unsafe.Pointer(cname))
+	return v.TruncateFill(name, size, false)
+}
 
-	// _, err := C.glfs_truncate(v.fs, cname, C.off_t(size))
+// TruncateFill is like Truncate, but if fill is set and the file grows, the
+// extension is filled with allocated zeros with Zerofill rather than left as
+// a hole, for consumers which need the space to be reserved.
+//
+// Returns an error on failure
+func (v *Volume) TruncateFill(name string, size int64, fill bool) error {
+	f, err := v.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
 
-	// return err
-	return errors.New("Truncate not implemented")
+	var old int64
+	if fill {
+		if old, err = f.Size(); err != nil {
+			return &os.PathError{Op: "truncate", Path: name, Err: err}
+		}
+	}
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	if fill && size > old {
+		if err := f.Zerofill(old, size-old); err != nil {
+			return err
+		}
+	}
+	return f.Close()
 }
 
 // Rename a file or directory
 //
 // Returns error on failure
 func (v *Volume) Rename(oldpath string, newpath string) error {
+	if !v.mounted {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: ErrNotMounted}
+	}
 
 	coldpath := C.CString(oldpath)
 	defer C.free(unsafe.Pointer(coldpath))
@@ -457,16 +2198,139 @@ func (v *Volume) Rename(oldpath string, newpath string) error {
 	defer C.free(unsafe.Pointer(cnewpath))
 
 	ret, err := C.glfs_rename(v.fs, coldpath, cnewpath)
+	v.invalidateStat(oldpath, newpath)
 	if int(ret) < 0 {
 		return err
 	}
 	return nil
 }
 
+// RenameIfNotExists renames oldpath to newpath unless newpath exists, in
+// which case it fails with EEXIST and renames nothing. A dangling symbolic
+// link at newpath counts as existing.
+//
+// This is best effort: newpath is checked before renaming, so a newpath
+// created in between is still replaced. gfapi has no rename with
+// RENAME_NOREPLACE that would close that window.
+//
+// Returns an *os.LinkError on failure
+func (v *Volume) RenameIfNotExists(oldpath, newpath string) error {
+	_, err := v.Lstat(newpath)
+	if err == nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EEXIST}
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+
+	if err := v.Rename(oldpath, newpath); err != nil {
+		if _, ok := err.(*os.LinkError); !ok {
+			err = &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+		}
+		return err
+	}
+	return nil
+}
+
+// moveRename renames for Move, and can be replaced in tests.
+var moveRename = (*Volume).Rename
+
+// Move renames oldpath to newpath like Rename, replacing newpath if it
+// exists. If the rename fails with EXDEV, as it may across quota or other
+// translator boundaries, a regular file is moved by copying it instead. The
+// copy gets the data, the extended attributes readable by the client (see
+// GetAllXattrs), the permission and special mode bits and the access and
+// modification times of oldpath, so that a move looks the same whether the
+// file was renamed or copied, but for its inode number and ownership, which
+// is that of the caller. The copy is made under a temporary name next to
+// newpath and renamed into place before oldpath is removed, so newpath is
+// never seen incomplete.
+//
+// Directories and other files are not copied, Move returns the EXDEV error.
+//
+// Returns an *os.LinkError on failure. If only removing oldpath fails, the
+// file is left under both names.
+func (v *Volume) Move(oldpath, newpath string) error {
+	err := moveRename(v, oldpath, newpath)
+	if errors.Is(err, syscall.EXDEV) {
+		if info, lerr := v.Lstat(oldpath); lerr == nil && info.Mode().IsRegular() {
+			err = v.moveCopy(oldpath, newpath, info)
+		}
+	}
+	if err != nil {
+		if _, ok := err.(*os.LinkError); !ok {
+			err = &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+		}
+		return err
+	}
+	return nil
+}
+
+// moveCopy moves the regular file oldpath described by info to newpath by
+// copying it, for Move.
+func (v *Volume) moveCopy(oldpath, newpath string, info os.FileInfo) error {
+	xattrs, err := v.GetAllXattrs(oldpath)
+	if err != nil {
+		return err
+	}
+
+	in, err := v.OpenReadOnly(oldpath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := path.Join(path.Dir(newpath), "."+path.Base(newpath)+".tmp"+strconv.FormatUint(rand.Uint64(), 36))
+	out, err := v.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		out.Close()
+		v.Unlink(tmp)
+		return err
+	}
+
+	if _, err := v.CopyRange(out, 0, in, 0, info.Size()); err != nil {
+		return fail(err)
+	}
+	if errs := v.SetAllXattrs(tmp, xattrs, 0); errs != nil {
+		return fail(errors.Join(errs...))
+	}
+	if err := out.Sync(); err != nil {
+		return fail(&os.PathError{Op: "fsync", Path: tmp, Err: err})
+	}
+	if err := out.Close(); err != nil {
+		return fail(err)
+	}
+
+	// The mode is set once written, as writes may clear setuid and setgid,
+	// and after any ACL, which sets the group bits along with its mask.
+	if err := v.Chmod(tmp, info.Mode()); err != nil {
+		return fail(&os.PathError{Op: "chmod", Path: tmp, Err: err})
+	}
+	atime := TimeOmit
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		atime = timespecToTime(getLastAccess(st))
+	}
+	if err := v.Utimens(tmp, atime, info.ModTime()); err != nil {
+		return fail(err)
+	}
+
+	if err := v.Rename(tmp, newpath); err != nil {
+		return fail(err)
+	}
+	return v.Unlink(oldpath)
+}
+
 // Get value of the extended attribute 'attr' and place it in 'dest'
 //
 // Returns number of bytes placed in 'dest' and error if any
 func (v *Volume) Getxattr(path string, attr string, dest []byte) (int64, error) {
+	if err := v.checkMounted("getxattr", path); err != nil {
+		return -1, err
+	}
+
 	var ret C.ssize_t
 	var err error
 
@@ -494,6 +2358,9 @@ func (v *Volume) Getxattr(path string, attr string, dest []byte) (int64, error)
 //
 // Returns error on failure
 func (v *Volume) Setxattr(path string, attr string, data []byte, flags int) error {
+	if err := v.checkMounted("setxattr", path); err != nil {
+		return err
+	}
 
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
@@ -501,8 +2368,13 @@ func (v *Volume) Setxattr(path string, attr string, data []byte, flags int) erro
 	cattr := C.CString(attr)
 	defer C.free(unsafe.Pointer(cattr))
 
+	var value unsafe.Pointer
+	if len(data) > 0 {
+		value = unsafe.Pointer(&data[0])
+	}
+
 	ret, err := C.glfs_setxattr(v.fs, cpath, cattr,
-		unsafe.Pointer(&data[0]), C.size_t(len(data)),
+		value, C.size_t(len(data)),
 		C.int(flags))
 
 	if ret == 0 {
@@ -515,6 +2387,9 @@ func (v *Volume) Setxattr(path string, attr string, data []byte, flags int) erro
 //
 // Returns error on failure
 func (v *Volume) Removexattr(path string, attr string) error {
+	if err := v.checkMounted("removexattr", path); err != nil {
+		return err
+	}
 
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
@@ -530,10 +2405,182 @@ func (v *Volume) Removexattr(path string, attr string) error {
 	return err
 }
 
+// List the names of the extended attributes of 'path' and place them in
+// 'dest' as a sequence of NUL terminated strings
+//
+// Returns number of bytes placed in 'dest' and error if any
+func (v *Volume) Listxattr(path string, dest []byte) (int64, error) {
+	if err := v.checkMounted("listxattr", path); err != nil {
+		return -1, err
+	}
+
+	var ret C.ssize_t
+	var err error
+
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	if len(dest) <= 0 {
+		ret, err = C.glfs_listxattr(v.fs, cpath, nil, 0)
+	} else {
+		ret, err = C.glfs_listxattr(v.fs, cpath,
+			unsafe.Pointer(&dest[0]), C.size_t(len(dest)))
+	}
+
+	if ret >= 0 {
+		return int64(ret), nil
+	}
+	return int64(ret), err
+}
+
+// GetxattrValue returns the value of the extended attribute 'attr' of
+// 'path' in a slice of exactly its size, see File.GetxattrValue.
+//
+// Reading attributes of the user.* and system.* namespaces only needs access
+// to the file, but the trusted.* namespace needs CAP_SYS_ADMIN, and some
+// security.* attributes are hidden from unprivileged clients by the bricks.
+//
+// Returns an error wrapping ErrNoXattr if the file has no such attribute,
+// one wrapping ErrXattrPermission if reading it is denied, and an error on failure
+func (v *Volume) GetxattrValue(path, attr string) ([]byte, error) {
+	if err := v.checkMounted("getxattr", path); err != nil {
+		return nil, err
+	}
+
+	value, err := xattrBuffer(func(dest []byte) (int64, error) {
+		return v.Getxattr(path, attr, dest)
+	})
+	if err == syscall.ENODATA {
+		err = ErrNoXattr
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "getxattr", Path: path, Err: xattrError(attr, err)}
+	}
+	return value, nil
+}
+
+// ListUserXattrs returns the names of the extended attributes of 'path' in
+// the user.* namespace, sorted, leaving out the trusted.*, system.* and other
+// attributes gluster and the system keep for themselves. The names of the
+// attributes in the namespaces listed in include, such as "trusted" or
+// "system", are returned as well.
+//
+// Returns an error on failure
+func (v *Volume) ListUserXattrs(path string, include ...string) ([]string, error) {
+	if err := v.checkMounted("listxattr", path); err != nil {
+		return nil, err
+	}
+
+	list, err := xattrBuffer(func(dest []byte) (int64, error) {
+		return v.Listxattr(path, dest)
+	})
+	if err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: path, Err: err}
+	}
+
+	names := slices.DeleteFunc(xattrNames(list), func(attr string) bool {
+		ns, _, _ := strings.Cut(attr, ".")
+		return ns != "user" && !slices.Contains(include, ns)
+	})
+	sort.Strings(names)
+	return names, nil
+}
+
+// XattrSize returns the size of the value of the extended attribute 'attr'
+// of 'path' without reading the value, e.g. to check cheaply that it is set.
+//
+// Returns an error wrapping ErrNoXattr if the file has no such attribute,
+// one wrapping ErrXattrPermission if reading it is denied, and an error on failure
+func (v *Volume) XattrSize(path, attr string) (int64, error) {
+	size, err := v.Getxattr(path, attr, nil)
+	if _, ok := err.(*os.PathError); ok {
+		return 0, err
+	}
+	if err == syscall.ENODATA {
+		err = ErrNoXattr
+	}
+	if err != nil {
+		return 0, &os.PathError{Op: "getxattr", Path: path, Err: xattrError(attr, err)}
+	}
+	return size, nil
+}
+
+// GetAllXattrs returns the names and values of all the extended attributes
+// of 'path'. Attributes removed while they are being read are left out.
+//
+// Returns an error on failure
+func (v *Volume) GetAllXattrs(path string) (map[string][]byte, error) {
+	if err := v.checkMounted("getxattr", path); err != nil {
+		return nil, err
+	}
+
+	list, err := xattrBuffer(func(dest []byte) (int64, error) {
+		return v.Listxattr(path, dest)
+	})
+	if err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: path, Err: err}
+	}
+
+	attrs := make(map[string][]byte)
+	for _, attr := range xattrNames(list) {
+		value, err := xattrBuffer(func(dest []byte) (int64, error) {
+			return v.Getxattr(path, attr, dest)
+		})
+		if err == syscall.ENODATA {
+			continue
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "getxattr", Path: path, Err: err}
+		}
+		attrs[attr] = value
+	}
+	return attrs, nil
+}
+
+// SetAllXattrs sets the extended attributes of 'path' to the names and values
+// in attrs, in the order of their names, with Setxattr flags 'flags'.
+// SetAllXattrs carries on past failures.
+//
+// Returns one error per attribute that could not be set, naming the attribute,
+// or nil if all of them were set
+func (v *Volume) SetAllXattrs(path string, attrs map[string][]byte, flags int) []error {
+	if err := v.checkMounted("setxattr", path); err != nil {
+		return []error{err}
+	}
+
+	names := make([]string, 0, len(attrs))
+	for attr := range attrs {
+		names = append(names, attr)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, attr := range names {
+		if err := v.Setxattr(path, attr, attrs[attr], flags); err != nil {
+			errs = append(errs, &os.PathError{Op: "setxattr", Path: path, Err: fmt.Errorf("%s: %w", attr, xattrError(attr, err))})
+		}
+	}
+	return errs
+}
+
 // Get filesystem statistics
+// The result may come from the statvfs cache, see EnableStatvfsCache.
 //
 // Returns an error on failure
 func (v *Volume) Statvfs(path string, buf *Statvfs_t) error {
+	if err := v.checkMounted("statvfs", path); err != nil {
+		return err
+	}
+	if v.statvfsCache != nil {
+		return v.statvfsCache.statvfs(path, buf)
+	}
+	return v.statvfs(path, buf)
+}
+
+func (v *Volume) statvfs(path string, buf *Statvfs_t) error {
+	if err := v.checkMounted("statvfs", path); err != nil {
+		return err
+	}
 
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
@@ -0,0 +1,151 @@
+package gfapi
+
+// This file includes the walking of directory trees on a Volume, like the
+// 'path/filepath' package does for the local filesystem
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+)
+
+// WalkDir walks the file tree rooted at root, calling fn for each file or
+// directory in the tree, including root. It behaves like filepath.WalkDir:
+// files are walked in lexical order, symbolic links are not followed, and fn
+// may return fs.SkipDir or fs.SkipAll to prune the walk.
+func (v *Volume) WalkDir(root string, fn fs.WalkDirFunc) error {
+	info, err := v.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = v.walkDir(root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkDir recursively descends name, calling fn.
+//
+// Based on the walkDir function in the pkg/path/filepath/path.go file in the Go source
+func (v *Volume) walkDir(name string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(name, d, nil); err != nil || !d.IsDir() {
+		if err == fs.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+
+	entries, err := v.ReadDir(name)
+	if err != nil {
+		// Second call, to report the ReadDir error.
+		err = fn(name, d, err)
+		if err != nil {
+			if err == fs.SkipDir && d.IsDir() {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	for _, e := range entries {
+		if err := v.walkDir(path.Join(name, e.Name()), e, fn); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkParallel walks the file tree rooted at root like WalkDir, calling fn
+// with the os.FileInfo of each file or directory in the tree, including root.
+// The directories are listed and their entries are stat'ed by up to workers
+// goroutines at a time, which makes walking large trees much faster than
+// WalkDir when each stat is a round trip to the bricks.
+//
+// The order in which fn is called is not guaranteed, not even that of a
+// directory and its entries, but fn is never called concurrently, so it does
+// not need to synchronize. Symbolic links are not followed. WalkParallel
+// carries on past failures.
+//
+// Returns the first error encountered
+func (v *Volume) WalkParallel(root string, workers int, fn func(path string, info os.FileInfo)) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		mu      sync.Mutex
+		cond    = sync.NewCond(&mu)
+		queue   = []string{root}
+		pending = 1 // paths queued or being walked
+		first   error
+		fnMu    sync.Mutex
+		wg      sync.WaitGroup
+	)
+
+	worker := func() {
+		defer wg.Done()
+
+		mu.Lock()
+		defer mu.Unlock()
+		for {
+			for len(queue) == 0 && pending > 0 {
+				cond.Wait()
+			}
+			if pending == 0 {
+				cond.Broadcast()
+				return
+			}
+			name := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			mu.Unlock()
+
+			children, err := v.walkParallelOne(name, func(info os.FileInfo) {
+				fnMu.Lock()
+				defer fnMu.Unlock()
+				fn(name, info)
+			})
+
+			mu.Lock()
+			if err != nil && first == nil {
+				first = err
+			}
+			queue = append(queue, children...)
+			pending += len(children) - 1
+			cond.Broadcast()
+		}
+	}
+
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go worker()
+	}
+	wg.Wait()
+
+	return first
+}
+
+// walkParallelOne stats name for WalkParallel and passes the result to fn,
+// and returns the paths of its entries if it is a directory.
+func (v *Volume) walkParallelOne(name string, fn func(info os.FileInfo)) ([]string, error) {
+	info, err := v.Lstat(name)
+	if err != nil {
+		return nil, err
+	}
+	fn(info)
+	if !info.IsDir() {
+		return nil, nil
+	}
+
+	entries, err := v.ReadDir(name)
+	children := make([]string, len(entries))
+	for i, e := range entries {
+		children[i] = path.Join(name, e.Name())
+	}
+	return children, err
+}
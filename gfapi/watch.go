@@ -0,0 +1,472 @@
+package gfapi
+
+// This file includes the watching of paths for changes made by other clients
+// of the volume, driven by the cache invalidation upcalls of gfapi
+
+// #cgo pkg-config: glusterfs-api
+// #include "glusterfs/api/glfs.h"
+// #include <stdint.h>
+// #include <sys/stat.h>
+//
+// extern void goUpcallCallback(void *, uintptr_t);
+//
+// static void upcall_cbk(void *arg, void *data) {
+// 	goUpcallCallback(arg, (uintptr_t)data);
+// }
+//
+// typedef int (*upcall_register_fn)(glfs_t *, uint32_t, void (*)(void *, void *), void *);
+// typedef int (*upcall_unregister_fn)(glfs_t *, uint32_t);
+// typedef int (*upcall_get_reason_fn)(void *);
+// typedef void *(*upcall_get_ptr_fn)(void *);
+//
+// static int call_upcall_register(void *fn, glfs_t *fs, uint32_t events, uintptr_t data) {
+// 	return ((upcall_register_fn)fn)(fs, events, upcall_cbk, (void *)data);
+// }
+// static int call_upcall_unregister(void *fn, glfs_t *fs, uint32_t events) {
+// 	return ((upcall_unregister_fn)fn)(fs, events);
+// }
+// static int call_upcall_get_reason(void *fn, void *arg) {
+// 	return ((upcall_get_reason_fn)fn)(arg);
+// }
+// static void *call_upcall_get_ptr(void *fn, void *arg) {
+// 	return ((upcall_get_ptr_fn)fn)(arg);
+// }
+// static uint64_t stat_ino(void *st) {
+// 	return st ? ((struct stat *)st)->st_ino : 0;
+// }
+import "C"
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// GLFS_EVENT_INODE_INVALIDATE and GLFS_UPCALL_INODE_INVALIDATE from glfs.h
+const (
+	upcallEventInodeInvalidate  = 0x1
+	upcallReasonInodeInvalidate = 1
+)
+
+// watchRefresh is the interval at which watched paths are rescanned even
+// without upcalls. The bricks only send upcalls for inodes a client accessed
+// within features.cache-invalidation-timeout, which the rescan renews.
+var watchRefresh = 30 * time.Second
+
+// EventOp is the kind of change an Event reports.
+type EventOp int
+
+const (
+	EventCreate EventOp = iota + 1
+	EventModify
+	EventDelete
+)
+
+func (op EventOp) String() string {
+	switch op {
+	case EventCreate:
+		return "create"
+	case EventModify:
+		return "modify"
+	case EventDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Event is a change to a path watched with Volume.Watch.
+type Event struct {
+	Name string // full path of the changed file
+	Op   EventOp
+}
+
+// watchEntry is the state of a watched file compared between scans.
+type watchEntry struct {
+	ino   uint64
+	size  int64
+	mode  os.FileMode
+	mtime time.Time
+}
+
+func newWatchEntry(info os.FileInfo) watchEntry {
+	e := watchEntry{size: info.Size(), mode: info.Mode(), mtime: info.ModTime()}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		e.ino = st.Ino
+	}
+	return e
+}
+
+// watcher is a single path watched by Volume.Watch.
+type watcher struct {
+	v     *Volume
+	path  string
+	isDir bool
+
+	// entries is only used by the run goroutine.
+	entries map[string]watchEntry
+
+	// inos holds the inode numbers of the path and its entries, to match
+	// the upcalls against.
+	mu   sync.Mutex
+	inos map[uint64]bool
+
+	wake   chan struct{}
+	events chan Event
+	stop   chan struct{}
+	once   sync.Once
+
+	// done is closed once the run goroutine has returned, and with it any
+	// call into gfapi on its behalf.
+	done chan struct{}
+}
+
+// Watch starts watching the named file or directory, and returns the channel
+// the changes are delivered on and a function to stop watching, which closes
+// the channel. For a directory, the creation, modification and deletion of
+// its direct entries are reported; for any other file, its modification and
+// deletion. Deleting the watched path itself reports it and ends the watch.
+//
+// The events are translated from the cache invalidation upcalls gluster sends
+// to clients, which requires features.cache-invalidation to be enabled on
+// the volume. The upcalls name inodes rather than paths, so the watched path
+// is rescanned when one concerns it and the events are the differences found
+// since the previous scan. This bounds their granularity:
+//
+//   - changes between two scans are coalesced, a file created and deleted
+//     in between is missed and several writes are reported once
+//   - a rename is reported as a deletion and a creation
+//   - modifications are detected by a change of size, mode or mtime
+//   - subdirectories are not watched recursively
+//   - gluster sends no upcall to the client making a change, so changes made
+//     through v itself are only seen by the periodic rescan
+//
+// Returns an error wrapping ErrUnsupported if the loaded libgfapi lacks
+// upcalls, see Supports
+func (v *Volume) Watch(name string) (<-chan Event, func() error, error) {
+	if err := v.checkMounted("watch", name); err != nil {
+		return nil, nil, err
+	}
+	if featureFunc(FeatureUpcall) == nil {
+		return nil, nil, &os.PathError{Op: "watch", Path: name, Err: ErrUnsupported}
+	}
+
+	info, err := v.stat(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w := &watcher{
+		v:      v,
+		path:   name,
+		isDir:  info.IsDir(),
+		wake:   make(chan struct{}, 1),
+		events: make(chan Event, 64),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	entries, ino, err := w.scan()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.update(entries, ino)
+
+	if err := v.watch.add(v, w); err != nil {
+		return nil, nil, &os.PathError{Op: "watch", Path: name, Err: err}
+	}
+
+	go w.run()
+
+	return w.events, w.close, nil
+}
+
+// scan returns the current state of the watched path, keyed by full path,
+// and its inode number. The state of a directory is that of its entries, so
+// that the change of its own mtime along with them is not reported.
+func (w *watcher) scan() (map[string]watchEntry, uint64, error) {
+	info, err := w.v.stat(w.path)
+	if err != nil {
+		return nil, 0, err
+	}
+	self := newWatchEntry(info)
+	if !w.isDir {
+		return map[string]watchEntry{w.path: self}, self.ino, nil
+	}
+
+	infos, err := w.v.ReadDirFiltered(w.path, func(os.FileInfo) bool { return true })
+	if err != nil {
+		return nil, 0, err
+	}
+	entries := make(map[string]watchEntry, len(infos))
+	for _, info := range infos {
+		entries[path.Join(w.path, info.Name())] = newWatchEntry(info)
+	}
+	return entries, self.ino, nil
+}
+
+// update replaces the state of the watched path with entries.
+func (w *watcher) update(entries map[string]watchEntry, ino uint64) {
+	inos := map[uint64]bool{ino: true}
+	for _, e := range entries {
+		inos[e.ino] = true
+	}
+
+	w.entries = entries
+	w.mu.Lock()
+	w.inos = inos
+	w.mu.Unlock()
+}
+
+// concerns reports whether an upcall about the inodes inos may concern the
+// watched path. Zero inode numbers are unknown, so an upcall without any
+// known inode is assumed to concern every path.
+func (w *watcher) concerns(inos []uint64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	known := false
+	for _, ino := range inos {
+		if ino == 0 {
+			continue
+		}
+		if w.inos[ino] {
+			return true
+		}
+		known = true
+	}
+	return !known
+}
+
+// notify wakes the run goroutine up to rescan, without blocking. Wakeups
+// coalesce while a rescan is pending.
+func (w *watcher) notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run rescans the watched path whenever notified or refreshed, sending the
+// differences as events, until stopped or the path or volume is gone.
+func (w *watcher) run() {
+	defer close(w.done)
+	defer close(w.events)
+
+	ticker := time.NewTicker(watchRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-w.wake:
+		case <-ticker.C:
+		}
+
+		entries, ino, err := w.scan()
+		gone := errors.Is(err, fs.ErrNotExist)
+		if gone {
+			entries = nil
+		} else if errors.Is(err, ErrNotMounted) {
+			return
+		} else if err != nil {
+			// Transient failures are retried with the next wakeup
+			continue
+		}
+
+		events := diffWatchEntries(w.entries, entries)
+		if gone && w.isDir {
+			events = append(events, Event{Name: w.path, Op: EventDelete})
+		}
+		for _, ev := range events {
+			w.v.invalidateStat(ev.Name)
+			select {
+			case w.events <- ev:
+			case <-w.stop:
+				return
+			}
+		}
+		if gone {
+			w.v.watch.remove(w.v, w)
+			return
+		}
+		w.update(entries, ino)
+	}
+}
+
+// close stops the watcher, and with it the upcalls once no watcher is left.
+func (w *watcher) close() error {
+	var err error
+	w.once.Do(func() {
+		err = w.v.watch.remove(w.v, w)
+		close(w.stop)
+	})
+	return err
+}
+
+// diffWatchEntries returns the events turning old into cur, sorted by name.
+// A file replaced by another inode is reported as deleted, then created.
+func diffWatchEntries(old, cur map[string]watchEntry) []Event {
+	var events []Event
+	for name, o := range old {
+		c, ok := cur[name]
+		switch {
+		case !ok:
+			events = append(events, Event{Name: name, Op: EventDelete})
+		case c.ino != o.ino:
+			events = append(events, Event{Name: name, Op: EventDelete}, Event{Name: name, Op: EventCreate})
+		case c.size != o.size || c.mode != o.mode || !c.mtime.Equal(o.mtime):
+			events = append(events, Event{Name: name, Op: EventModify})
+		}
+	}
+	for name := range cur {
+		if _, ok := old[name]; !ok {
+			events = append(events, Event{Name: name, Op: EventCreate})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Name < events[j].Name })
+	return events
+}
+
+// watchState tracks the watchers of a Volume, registering the upcalls with
+// the first one and unregistering them with the last one.
+type watchState struct {
+	// regMu serializes the registration changes, mu guards watchers, which
+	// the upcall callback reads.
+	regMu    sync.Mutex
+	id       uint64
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+}
+
+// upcallVolumes maps the ids passed to the upcall callback to the Volumes,
+// so a callback racing with unregistering finds nothing rather than a stale
+// pointer.
+var (
+	upcallVolumes sync.Map
+	upcallLastID  atomic.Uint64
+)
+
+func (s *watchState) add(v *Volume, w *watcher) error {
+	s.regMu.Lock()
+	defer s.regMu.Unlock()
+
+	if s.id == 0 {
+		id := upcallLastID.Add(1)
+		upcallVolumes.Store(id, v)
+		ret, err := C.call_upcall_register(featureFunc(FeatureUpcall), v.fs, upcallEventInodeInvalidate, C.uintptr_t(id))
+		if int(ret) < 0 {
+			upcallVolumes.Delete(id)
+			return err
+		}
+		s.id = id
+	}
+
+	s.mu.Lock()
+	if s.watchers == nil {
+		s.watchers = make(map[*watcher]struct{})
+	}
+	s.watchers[w] = struct{}{}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *watchState) remove(v *Volume, w *watcher) error {
+	s.regMu.Lock()
+	defer s.regMu.Unlock()
+
+	s.mu.Lock()
+	delete(s.watchers, w)
+	last := len(s.watchers) == 0
+	s.mu.Unlock()
+	if !last || s.id == 0 {
+		return nil
+	}
+
+	upcallVolumes.Delete(s.id)
+	s.id = 0
+	fn := optionalFunc("glfs_upcall_unregister")
+	if fn == nil || v.fs == nil {
+		return nil
+	}
+	if ret, err := C.call_upcall_unregister(fn, v.fs, upcallEventInodeInvalidate); int(ret) < 0 {
+		return err
+	}
+	return nil
+}
+
+// closeAll stops all the watchers and waits for their goroutines to return,
+// as the volume is being unmounted and its glfs object is about to be freed.
+func (s *watchState) closeAll() {
+	s.mu.Lock()
+	watchers := make([]*watcher, 0, len(s.watchers))
+	for w := range s.watchers {
+		watchers = append(watchers, w)
+	}
+	s.mu.Unlock()
+
+	for _, w := range watchers {
+		w.close()
+		<-w.done
+	}
+}
+
+// notify wakes up the watchers an upcall about the inodes inos concerns.
+func (s *watchState) notify(inos []uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for w := range s.watchers {
+		if w.concerns(inos) {
+			w.notify()
+		}
+	}
+}
+
+// upcallCallback handles an upcall for the Volume registered as id, called
+// on a gfapi thread. The upcall is freed here, as gfapi expects.
+func upcallCallback(arg unsafe.Pointer, id uint64) {
+	defer C.glfs_free(arg)
+
+	v, ok := upcallVolumes.Load(id)
+	if !ok {
+		return
+	}
+
+	getReason := optionalFunc("glfs_upcall_get_reason")
+	if getReason != nil && C.call_upcall_get_reason(getReason, arg) != upcallReasonInodeInvalidate {
+		return
+	}
+	v.(*Volume).watch.notify(upcallInodes(arg))
+}
+
+// upcallInodes returns the inode numbers of the object of an inode
+// invalidation upcall and of its parents, zero where unknown.
+func upcallInodes(arg unsafe.Pointer) []uint64 {
+	getEvent := optionalFunc("glfs_upcall_get_event")
+	if getEvent == nil {
+		return nil
+	}
+	event := C.call_upcall_get_ptr(getEvent, arg)
+	if event == nil {
+		return nil
+	}
+
+	var inos []uint64
+	for _, symbol := range []string{
+		"glfs_upcall_inode_get_stat",
+		"glfs_upcall_inode_get_pstat",
+		"glfs_upcall_inode_get_oldpstat",
+	} {
+		if fn := optionalFunc(symbol); fn != nil {
+			inos = append(inos, uint64(C.stat_ino(C.call_upcall_get_ptr(fn, event))))
+		}
+	}
+	return inos
+}